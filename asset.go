@@ -0,0 +1,82 @@
+package jspacker
+
+import (
+	"cmp"
+	"encoding/base64"
+	"path"
+	"strings"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/parser"
+)
+
+var assetTypes = map[string]func(string, []byte) (*javascript.Module, error){
+	"json":    jsonAsset,
+	"text":    textAsset,
+	"bytes":   bytesAsset,
+	"dataurl": dataURLAsset,
+}
+
+var mimeTypes = map[string]string{
+	".avif":  "image/avif",
+	".bmp":   "image/bmp",
+	".css":   "text/css",
+	".csv":   "text/csv",
+	".gif":   "image/gif",
+	".htm":   "text/html",
+	".html":  "text/html",
+	".ico":   "image/x-icon",
+	".jpeg":  "image/jpeg",
+	".jpg":   "image/jpeg",
+	".js":    "text/javascript",
+	".json":  "application/json",
+	".mjs":   "text/javascript",
+	".mp3":   "audio/mpeg",
+	".mp4":   "video/mp4",
+	".oga":   "audio/ogg",
+	".ogg":   "audio/ogg",
+	".ogv":   "video/ogg",
+	".otf":   "font/otf",
+	".pdf":   "application/pdf",
+	".png":   "image/png",
+	".svg":   "image/svg+xml",
+	".ttf":   "font/ttf",
+	".txt":   "text/plain",
+	".wasm":  "application/wasm",
+	".wav":   "audio/wav",
+	".webm":  "video/webm",
+	".webp":  "image/webp",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".xml":   "application/xml",
+}
+
+func assetModule(typ, name string, data []byte) (*javascript.Module, error) {
+	return assetTypes[typ](name, data)
+}
+
+func jsonAsset(_ string, data []byte) (*javascript.Module, error) {
+	return JSONModule(data)
+}
+
+func textAsset(_ string, data []byte) (*javascript.Module, error) {
+	return defaultExportModule(jsonString(string(data)))
+}
+
+func bytesAsset(_ string, data []byte) (*javascript.Module, error) {
+	return defaultExportModule("Uint8Array.from(atob(\"" + base64.StdEncoding.EncodeToString(data) + "\"), c => c.charCodeAt(0))")
+}
+
+func dataURLAsset(name string, data []byte) (*javascript.Module, error) {
+	return defaultExportModule(jsonString("data:" + mimeType(name) + ";base64," + base64.StdEncoding.EncodeToString(data)))
+}
+
+func mimeType(name string) string {
+	return cmp.Or(mimeTypes[strings.ToLower(path.Ext(name))], "application/octet-stream")
+}
+
+func defaultExportModule(expr string) (*javascript.Module, error) {
+	tks := parser.NewStringTokeniser("export default " + expr + ";")
+
+	return javascript.ParseModule(&tks)
+}
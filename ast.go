@@ -207,6 +207,83 @@ func wrapIncludeCall(ident *javascript.Token, args []javascript.Argument) javasc
 	})
 }
 
+func wrapIncludeBindings(url string, bindings []includeBinding) javascript.ModuleItem {
+	var (
+		lbs   []javascript.LexicalBinding
+		props []javascript.BindingProperty
+	)
+
+	for _, b := range bindings {
+		if b.binding == "*" {
+			lbs = append(lbs, javascript.LexicalBinding{
+				BindingIdentifier: jToken(b.local),
+				Initializer:       awaitInclude(url),
+			})
+		} else {
+			props = append(props, javascript.BindingProperty{
+				PropertyName: javascript.PropertyName{
+					LiteralPropertyName: jToken(b.binding),
+				},
+				BindingElement: javascript.BindingElement{
+					SingleNameBinding: jToken(b.local),
+				},
+			})
+		}
+	}
+
+	if len(props) > 0 {
+		lbs = append(lbs, javascript.LexicalBinding{
+			ObjectBindingPattern: &javascript.ObjectBindingPattern{
+				BindingPropertyList: props,
+			},
+			Initializer: awaitInclude(url),
+		})
+	}
+
+	return wrapConst(lbs)
+}
+
+func awaitInclude(url string) *javascript.AssignmentExpression {
+	return awaitCall(&javascript.MemberExpression{
+		PrimaryExpression: &javascript.PrimaryExpression{
+			IdentifierReference: jToken("include"),
+		},
+	},
+		[]javascript.Argument{wrapArgument(url)},
+	)
+}
+
+func wrapNamedImport(url string, names []string) javascript.ModuleItem {
+	specifiers := make([]javascript.ImportSpecifier, len(names))
+
+	for n, name := range names {
+		specifiers[n].ImportedBinding = jToken(name)
+	}
+
+	return javascript.ModuleItem{
+		ImportDeclaration: &javascript.ImportDeclaration{
+			ImportClause: &javascript.ImportClause{
+				NamedImports: &javascript.NamedImports{
+					ImportList: specifiers,
+				},
+			},
+			FromClause: javascript.FromClause{
+				ModuleSpecifier: jToken(strconv.Quote(url)),
+			},
+		},
+	}
+}
+
+func wrapExportClause(exports []javascript.ExportSpecifier) javascript.ModuleItem {
+	return javascript.ModuleItem{
+		ExportDeclaration: &javascript.ExportDeclaration{
+			ExportClause: &javascript.ExportClause{
+				ExportList: exports,
+			},
+		},
+	}
+}
+
 func awaitCall(me *javascript.MemberExpression, args []javascript.Argument) *javascript.AssignmentExpression {
 	return &javascript.AssignmentExpression{
 		ConditionalExpression: javascript.WrapConditional(&javascript.UnaryExpression{
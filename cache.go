@@ -0,0 +1,115 @@
+package jspacker
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"vimagination.zapto.org/javascript"
+)
+
+// Cache stores parsed modules between calls to Package, so that modules that
+// have not changed do not need to be loaded again.
+//
+// Each call to Package receives its own copy of a cached module, so a Cache
+// can be shared between concurrent calls.
+type Cache struct {
+	key     func(string, string) (string, error)
+	mu      sync.Mutex
+	modules map[string]cachedModule
+}
+
+type cachedModule struct {
+	key, typ string
+	module   *javascript.Module
+}
+
+// NewCache creates a new Cache that uses the given func to determine whether a
+// cached module is still valid.
+//
+// The key func is called with the URL and import type of each module to be
+// loaded, and a cached module will only be used when the returned key matches
+// the one returned when that module was stored. If the key func returns an
+// error, the module will be loaded without using the cache.
+//
+// As the key is all that is checked, it must change whenever any file that
+// the module is built from changes. Modules that a loader builds from
+// multiple files, such as a stylesheet with its imports inlined, should either
+// have every file covered by the key, or be excluded from the cache by
+// returning an error for them.
+func NewCache(key func(url, typ string) (string, error)) *Cache {
+	return &Cache{
+		key:     key,
+		modules: make(map[string]cachedModule),
+	}
+}
+
+func (c *Cache) load(url, typ string, loader func(string, string) (*javascript.Module, error)) (*javascript.Module, error) {
+	key, err := c.key(url, typ)
+	if err != nil {
+		return loader(url, typ)
+	}
+
+	c.mu.Lock()
+	cm, ok := c.modules[url]
+	c.mu.Unlock()
+
+	if ok && cm.key == key && cm.typ == typ {
+		return cloneModule(cm.module), nil
+	}
+
+	m, err := loader(url, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.modules[url] = cachedModule{key: key, typ: typ, module: cloneModule(m)}
+	c.mu.Unlock()
+
+	return m, nil
+}
+
+// FileKey returns a key func, for use with NewCache, that identifies a module
+// by the path, modification time, and size of the file that OSLoad, with the
+// same base and options, would load for a URL.
+//
+// Only that file is covered by the key, so it is not suitable for loaders that
+// combine multiple files into a single module.
+func FileKey(base string, opts ...LoadOpt) func(string, string) (string, error) {
+	return FSFileKey(os.DirFS(cmp.Or(base, ".")), opts...)
+}
+
+// FSFileKey is like FileKey, but for modules loaded with FSLoad.
+func FSFileKey(fsys fs.FS, opts ...LoadOpt) func(string, string) (string, error) {
+	var l loadOpts
+
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	return func(urlPath, _ string) (string, error) {
+		var isTS, isJSX bool
+
+		for loader := range loadFns(fsys, urlPath, !l.disableTS, l.jsx != nil, &isTS, &isJSX) {
+			f, _ := loader()
+			if f == nil {
+				continue
+			}
+
+			fi, err := f.Stat()
+
+			f.Close()
+
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("%s:%d:%d", f.name, fi.ModTime().UnixNano(), fi.Size()), nil
+		}
+
+		return "", fs.ErrNotExist
+	}
+}
@@ -0,0 +1,70 @@
+package jspacker
+
+import (
+	"fmt"
+	"testing"
+
+	"vimagination.zapto.org/javascript"
+)
+
+func TestCache(t *testing.T) {
+	var (
+		input = loader{
+			"/a.js": "import {b} from './b.js'; import {c} from './c.js'; console.log(b, c);",
+			"/b.js": "export const b = 1;",
+			"/c.js": "export const c = 2;",
+		}
+		versions = map[string]int{}
+		loads    []string
+		cache    = NewCache(func(url, _ string) (string, error) {
+			return fmt.Sprint(versions[url]), nil
+		})
+	)
+
+	load := func(url string) (*javascript.Module, error) {
+		loads = append(loads, url)
+
+		return input.load(url)
+	}
+
+	for n, test := range [...]struct {
+		Change string
+		Loads  []string
+	}{
+		{ // 1
+			Loads: []string{"/a.js", "/b.js", "/c.js"},
+		},
+		{ // 2
+		},
+		{ // 3
+			Change: "/b.js",
+			Loads:  []string{"/b.js"},
+		},
+		{ // 4
+		},
+	} {
+		if test.Change != "" {
+			versions[test.Change]++
+		}
+
+		loads = nil
+
+		expected, err := Package(File("/a.js"), Loader(input.load))
+		if err != nil {
+			t.Fatalf("test %d: unexpected err: %s", n+1, err)
+		}
+
+		output, err := Package(File("/a.js"), Loader(load), UseCache(cache))
+		if err != nil {
+			t.Fatalf("test %d: unexpected err: %s", n+1, err)
+		}
+
+		if e, o := fmt.Sprintf("%s", expected), fmt.Sprintf("%s", output); e != o {
+			t.Errorf("test %d: expecting output: %q\ngot: %q", n+1, e, o)
+		}
+
+		if fmt.Sprint(loads) != fmt.Sprint(test.Loads) {
+			t.Errorf("test %d: expecting loads %v, got %v", n+1, test.Loads, loads)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package jspacker
+
+import (
+	"reflect"
+
+	"vimagination.zapto.org/javascript"
+)
+
+var tokenType = reflect.TypeFor[javascript.Token]()
+
+type clonePtr struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+type cloner map[clonePtr]reflect.Value
+
+func cloneModule(m *javascript.Module) *javascript.Module {
+	return make(cloner).clone(reflect.ValueOf(m)).Interface().(*javascript.Module)
+}
+
+func (c cloner) clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+
+		key := clonePtr{ptr: v.Pointer(), typ: v.Type()}
+
+		if p, ok := c[key]; ok {
+			return p
+		}
+
+		p := reflect.New(v.Type().Elem())
+		c[key] = p
+
+		c.cloneInto(p.Elem(), v.Elem())
+
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		i := reflect.New(v.Type()).Elem()
+
+		i.Set(c.clone(v.Elem()))
+
+		return i
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem() == tokenType { // token lists are only read, so can be shared
+			return v
+		}
+
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+
+		for n := range v.Len() {
+			c.cloneInto(s.Index(n), v.Index(n))
+		}
+
+		return s
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+
+		for iter := v.MapRange(); iter.Next(); {
+			m.SetMapIndex(iter.Key(), c.clone(iter.Value()))
+		}
+
+		return m
+	case reflect.Struct, reflect.Array:
+		s := reflect.New(v.Type()).Elem()
+
+		c.cloneInto(s, v)
+
+		return s
+	}
+
+	return v
+}
+
+func (c cloner) cloneInto(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Struct:
+		dst.Set(src)
+
+		for n := range src.NumField() {
+			if f := dst.Field(n); f.CanSet() {
+				c.cloneInto(f, src.Field(n))
+			}
+		}
+	case reflect.Array:
+		for n := range src.Len() {
+			c.cloneInto(dst.Index(n), src.Index(n))
+		}
+	default:
+		dst.Set(c.clone(src))
+	}
+}
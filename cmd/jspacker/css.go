@@ -2,13 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"vimagination.zapto.org/css"
+	"vimagination.zapto.org/javascript"
 	"vimagination.zapto.org/parser"
 )
 
@@ -41,6 +44,41 @@ func (c cssLoader) Open() (io.ReadCloser, error) {
 	return os.Open(filepath.Join(c.base, c.path))
 }
 
+func (c *Config) cssModules(loader func(string, string) (*javascript.Module, error)) func(string, string) (*javascript.Module, error) {
+	return func(url, typ string) (*javascript.Module, error) {
+		if typ != "css" {
+			return loader(url, typ)
+		}
+
+		return c.cssModule(url)
+	}
+}
+
+func (c *Config) cssModule(url string) (*javascript.Module, error) {
+	var buf bytes.Buffer
+
+	if err := combineCSS(c.watchCSS(cssLoader{base: c.base, path: filepath.FromSlash(url)}), &buf, c.minimiseCSS); err != nil {
+		return nil, fmt.Errorf("error processing CSS module (%s): %w", url, err)
+	}
+
+	text, _ := json.Marshal(buf.String())
+	tks := parser.NewStringTokeniser("const sheet = new CSSStyleSheet();\n\nsheet.replaceSync(" + string(text) + ");\n\nexport default sheet;")
+
+	return javascript.ParseModule(&tks)
+}
+
+// uncachedCSS excludes CSS modules from the cache, as they are combined with
+// the stylesheets they import, which the key does not cover.
+func uncachedCSS(key func(string, string) (string, error)) func(string, string) (string, error) {
+	return func(url, typ string) (string, error) {
+		if typ == "css" {
+			return "", ErrUncachedCSS
+		}
+
+		return key(url, typ)
+	}
+}
+
 type cssImport struct {
 	imports, layer, supports, media []parser.Token
 }
@@ -456,3 +494,5 @@ func parseRemaining(p *parser.Parser) (parser.Phrase, parser.PhraseFunc) {
 
 	return p.Return(phraseRemaining, (*parser.Parser).Done)
 }
+
+var ErrUncachedCSS = errors.New("CSS modules are not cached")
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"testing"
 
 	"vimagination.zapto.org/css"
+	"vimagination.zapto.org/jspacker"
 	"vimagination.zapto.org/parser"
 )
 
@@ -721,3 +723,60 @@ func TestCombineCSSOS(t *testing.T) {
 		t.Fatalf("expecting err ErrNotExist, got %v", err)
 	}
 }
+
+func TestCSSModule(t *testing.T) {
+	tmp := t.TempDir()
+
+	for file, data := range map[string]string{
+		"a.css":   "@import url(b.css);a{}",
+		"b.css":   "b{}",
+		"main.js": "import sheet from './a.css' with {type: 'css'}; document.adoptedStyleSheets = [sheet];",
+	} {
+		if err := os.WriteFile(filepath.Join(tmp, file), []byte(data), 0600); err != nil {
+			t.Fatalf("unexpected error writing file: %v", err)
+		}
+	}
+
+	c := Config{base: tmp, filesTodo: Inputs{"/main.js"}, noExports: true}
+
+	m, err := jspacker.Package(c.Options()...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const expected = "const b_sheet = new CSSStyleSheet();\n\nb_sheet.replaceSync(\"b{}a{}\");\n\nconst b_default = b_sheet;\n\ndocument.adoptedStyleSheets = [b_default];"
+
+	if output := strings.ReplaceAll(fmt.Sprintf("%s", m), "\t", ""); output != expected {
+		t.Errorf("expecting output %q, got %q", expected, output)
+	}
+}
+
+func TestUncachedCSS(t *testing.T) {
+	key := uncachedCSS(func(url, _ string) (string, error) {
+		return url, nil
+	})
+
+	for n, test := range [...]struct {
+		URL, Type, Output string
+		Err               error
+	}{
+		{ // 1
+			"/a.js", "", "/a.js", nil,
+		},
+		{ // 2
+			"/a.css", "css", "", ErrUncachedCSS,
+		},
+		{ // 3
+			"/a.txt", "css", "", ErrUncachedCSS,
+		},
+		{ // 4
+			"/a.css", "text", "/a.css", nil,
+		},
+	} {
+		if output, err := key(test.URL, test.Type); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"vimagination.zapto.org/jspacker"
+)
+
+func (c *Config) writeGraph() (err error) {
+	g, err := jspacker.Graph(c.Options()...)
+	if err != nil {
+		return fmt.Errorf("error generating import graph: %w", err)
+	}
+
+	f, err := c.outputFile()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			abortOutput(f)
+		}
+
+		if errr := f.Close(); err == nil && errr != nil {
+			err = fmt.Errorf("error closing output: %w", errr)
+		}
+	}()
+
+	if err := encodeGraph(f, c.graph, g); err != nil {
+		return fmt.Errorf("error writing import graph: %w", err)
+	}
+
+	return nil
+}
+
+func encodeGraph(w io.Writer, format string, g *jspacker.ImportGraph) error {
+	if format == "dot" {
+		return g.WriteDOT(w)
+	}
+
+	enc := json.NewEncoder(w)
+
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(g)
+}
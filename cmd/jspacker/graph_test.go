@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/jspacker"
+)
+
+func TestEncodeGraph(t *testing.T) {
+	g := &jspacker.ImportGraph{
+		Modules: []jspacker.GraphModule{{URL: "/a.js", Entry: true}, {URL: "/b.js"}},
+		Edges:   []jspacker.GraphEdge{{From: "/a.js", To: "/b.js", Kind: jspacker.EdgeDynamic}},
+	}
+
+	for n, test := range [...]struct {
+		Format, Output string
+	}{
+		{ // 1
+			"dot",
+			"digraph imports {\n\t\"/a.js\" [peripheries=2];\n\t\"/b.js\";\n\t\"/a.js\" -> \"/b.js\" [style=dotted];\n}\n",
+		},
+		{ // 2
+			"json",
+			"{\n\t\"modules\": [\n\t\t{\n\t\t\t\"url\": \"/a.js\",\n\t\t\t\"entry\": true\n\t\t},\n\t\t{\n\t\t\t\"url\": \"/b.js\"\n\t\t}\n\t],\n\t\"edges\": [\n\t\t{\n\t\t\t\"from\": \"/a.js\",\n\t\t\t\"to\": \"/b.js\",\n\t\t\t\"kind\": \"dynamic\"\n\t\t}\n\t]\n}\n",
+		},
+	} {
+		var sb strings.Builder
+
+		if err := encodeGraph(&sb, test.Format, g); err != nil {
+			t.Errorf("test %d: unexpected error: %v", n+1, err)
+		} else if output := sb.String(); output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/javascript/walk"
+)
+
+const manifestName = "manifest.json"
+
+type hashedFile struct {
+	bytes.Buffer
+	output  string
+	aborted bool
+}
+
+// Abort stops the buffered output from being written when the file is closed.
+func (h *hashedFile) Abort() {
+	h.aborted = true
+}
+
+func (h *hashedFile) Close() error {
+	if h.aborted {
+		return nil
+	}
+
+	_, err := writeHashed(h.output, h.Bytes())
+
+	return err
+}
+
+func abortOutput(f io.Writer) {
+	if a, ok := f.(interface{ Abort() }); ok {
+		a.Abort()
+	}
+}
+
+// writeHashed writes the data to the output path, with its hash added to the
+// filename, and records the new name in the manifest.
+func writeHashed(output string, data []byte) (string, error) {
+	name := hashedName(filepath.Base(output), data)
+	dir := filepath.Dir(output)
+
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return "", fmt.Errorf("error writing hashed output: %w", err)
+	}
+
+	return name, updateManifest(filepath.Join(dir, manifestName), filepath.Base(output), name)
+}
+
+func hashedName(name string, data []byte) string {
+	hash := sha256.Sum256(data)
+
+	return withHash(name, hash[:])
+}
+
+func withHash(name string, hash []byte) string {
+	base, ext, _ := strings.Cut(name, ".")
+
+	if ext != "" {
+		ext = "." + ext
+	}
+
+	return base + "." + hex.EncodeToString(hash[:4]) + ext
+}
+
+type chunkFile struct {
+	url    string
+	module *javascript.Module
+}
+
+// writeHashedChunks writes the chunks collected while packaging with their
+// hashes added to their filenames, rewriting the references to them in the
+// main module and other chunks.
+//
+// As chunks can dynamically import each other, the hash of each chunk is that
+// of the original contents of every chunk reachable from it.
+func (c *Config) writeHashedChunks(main *javascript.Module) error {
+	chunks := c.chunks
+	c.chunks = nil
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	var (
+		indexes  = make(map[string]int, len(chunks))
+		contents = make([][]byte, len(chunks))
+		deps     = make([][]int, len(chunks))
+		refs     [][]*javascript.Token
+		hashed   = make(map[string]string, len(chunks))
+	)
+
+	for n, ch := range chunks {
+		indexes[ch.url] = n
+	}
+
+	refs = append(refs, chunkReferences(main, indexes))
+
+	for n, ch := range chunks {
+		var buf bytes.Buffer
+
+		if err := c.printChunk(&buf, ch.module); err != nil {
+			return err
+		}
+
+		contents[n] = buf.Bytes()
+		tks := chunkReferences(ch.module, indexes)
+		refs = append(refs, tks)
+
+		for _, tk := range tks {
+			url, _ := javascript.Unquote(tk.Data)
+			deps[n] = append(deps[n], indexes[url])
+		}
+	}
+
+	for n, ch := range chunks {
+		h := sha256.New()
+
+		for _, m := range reachableChunks(chunks, deps, n) {
+			h.Write(contents[m])
+		}
+
+		hashed[ch.url] = path.Join(path.Dir(ch.url), withHash(path.Base(ch.url), h.Sum(nil)))
+	}
+
+	for _, tks := range refs {
+		for _, tk := range tks {
+			url, _ := javascript.Unquote(tk.Data)
+			tk.Data = strconv.Quote(hashed[url])
+		}
+	}
+
+	manifest := filepath.Join(filepath.Dir(c.output), manifestName)
+
+	for _, ch := range chunks {
+		if err := c.writeChunkFile(ch.url, hashed[ch.url], ch.module); err != nil {
+			return err
+		} else if err := updateManifest(manifest, ch.url, hashed[ch.url]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func chunkReferences(m *javascript.Module, chunks map[string]int) []*javascript.Token {
+	var (
+		tks  []*javascript.Token
+		find walk.HandlerFunc
+	)
+
+	add := func(tk *javascript.Token) {
+		if tk == nil || tk.Type != javascript.TokenStringLiteral {
+			return
+		}
+
+		if url, err := javascript.Unquote(tk.Data); err == nil {
+			if _, ok := chunks[url]; ok {
+				tks = append(tks, tk)
+			}
+		}
+	}
+
+	find = func(t javascript.Type) error {
+		switch t := t.(type) {
+		case *javascript.FromClause:
+			add(t.ModuleSpecifier)
+		case *javascript.PrimaryExpression:
+			add(t.Literal)
+		}
+
+		return walk.Walk(t, find)
+	}
+
+	walk.Walk(m, find)
+
+	return tks
+}
+
+func reachableChunks(chunks []chunkFile, deps [][]int, from int) []int {
+	var (
+		seen = map[int]bool{from: true}
+		todo = []int{from}
+	)
+
+	for len(todo) > 0 {
+		n := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		for _, d := range deps[n] {
+			if !seen[d] {
+				seen[d] = true
+				todo = append(todo, d)
+			}
+		}
+	}
+
+	reachable := slices.Collect(maps.Keys(seen))
+
+	slices.SortFunc(reachable, func(a, b int) int {
+		return strings.Compare(chunks[a].url, chunks[b].url)
+	})
+
+	return reachable
+}
+
+func updateManifest(manifest, name, hashed string) error {
+	entries := make(map[string]string)
+
+	if data, err := os.ReadFile(manifest); err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("error reading manifest: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading manifest: %w", err)
+	}
+
+	entries[name] = hashed
+
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(manifest, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+
+	return nil
+}
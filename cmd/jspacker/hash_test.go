@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHashedFile(t *testing.T) {
+	tmp := t.TempDir()
+
+	for n, test := range [...]struct {
+		Output, Data, Hashed string
+	}{
+		{ // 1
+			"main.js", "abc", "main.ba7816bf.js",
+		},
+		{ // 2
+			"style.min.css", "", "style.e3b0c442.min.css",
+		},
+		{ // 3
+			"main.js", "abcd", "main.88d4266f.js",
+		},
+	} {
+		h := hashedFile{output: filepath.Join(tmp, test.Output)}
+
+		h.WriteString(test.Data)
+
+		if err := h.Close(); err != nil {
+			t.Errorf("test %d: unexpected error: %v", n+1, err)
+		} else if data, err := os.ReadFile(filepath.Join(tmp, test.Hashed)); err != nil {
+			t.Errorf("test %d: unexpected error reading hashed file: %v", n+1, err)
+		} else if string(data) != test.Data {
+			t.Errorf("test %d: expecting data %q, got %q", n+1, test.Data, data)
+		}
+	}
+
+	const expected = "{\n\t\"main.js\": \"main.88d4266f.js\",\n\t\"style.min.css\": \"style.e3b0c442.min.css\"\n}\n"
+
+	if data, err := os.ReadFile(filepath.Join(tmp, manifestName)); err != nil {
+		t.Errorf("unexpected error reading manifest: %v", err)
+	} else if string(data) != expected {
+		t.Errorf("expecting manifest %q, got %q", expected, data)
+	}
+}
+
+func TestHashedFileAbort(t *testing.T) {
+	tmp := t.TempDir()
+	h := hashedFile{output: filepath.Join(tmp, "main.js")}
+
+	h.WriteString("abc")
+	abortOutput(&h)
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entries, err := os.ReadDir(tmp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(entries) != 0 {
+		t.Errorf("expecting no files to be written, got %d", len(entries))
+	}
+}
+
+func TestReachableChunks(t *testing.T) {
+	chunks := []chunkFile{
+		{url: "/chunks/chunk-d.js"},
+		{url: "/chunks/chunk-a.js"},
+		{url: "/chunks/chunk-c.js"},
+		{url: "/chunks/chunk-b.js"},
+	}
+	deps := [][]int{
+		{2},
+		{},
+		{0},
+		{1},
+	}
+
+	for n, test := range [...]struct {
+		From      int
+		Reachable []int
+	}{
+		{ // 1
+			From:      0,
+			Reachable: []int{2, 0},
+		},
+		{ // 2
+			From:      1,
+			Reachable: []int{1},
+		},
+		{ // 3
+			From:      2,
+			Reachable: []int{2, 0},
+		},
+		{ // 4
+			From:      3,
+			Reachable: []int{1, 3},
+		},
+	} {
+		if reachable := reachableChunks(chunks, deps, test.From); !slices.Equal(reachable, test.Reachable) {
+			t.Errorf("test %d: expecting reachable chunks %v, got %v", n+1, test.Reachable, reachable)
+		}
+	}
+}
@@ -29,18 +29,28 @@ func (c *Config) processHTML() (err error) {
 		return err
 	}
 
+	c.meta = nil
+
 	f, err := c.outputFile()
 	if err != nil {
 		return err
 	}
 
 	defer func() {
+		if err != nil {
+			abortOutput(f)
+		}
+
 		if errr := f.Close(); err == nil {
 			err = errr
 		}
 	}()
 
-	return c.writeHTML(f, h)
+	if err := c.writeHTML(f, h); err != nil {
+		return err
+	}
+
+	return c.writeMetafile()
 }
 
 func (c *Config) processHTMLInput() (*htmlState, error) {
@@ -53,6 +63,8 @@ func (c *Config) processHTMLInput() (*htmlState, error) {
 	if c.filesTodo[0] != "-" {
 		var err error
 
+		c.watched.add(filepath.Join(c.base, c.filesTodo[0]))
+
 		f, err = os.Open(filepath.Join(c.base, c.filesTodo[0]))
 		if err != nil {
 			return nil, err
@@ -127,15 +139,26 @@ func (c *Config) processScript(w io.Writer, html string, script tag) error {
 
 	if script.src == "" {
 		c.filesTodo[0] = "/\x00"
-		opts = append(c.Options(), jspacker.Loader(scriptLoader(html[script.contentStart:script.contentEnd], c.base, c.jsx)))
+		opts = append(c.Options(), jspacker.TypedLoader(c.cssModules(scriptLoader(html[script.contentStart:script.contentEnd], c.base, c.jsx, append(c.sourceNameOpts(), c.assetTypeOpts()...)...))))
 	} else {
-		c.filesTodo[0] = c.importMap.Resolve("/", script.src)
+		src, err := c.importMap.Resolve("/", script.src)
+		if err != nil {
+			return err
+		}
+
+		c.filesTodo[0] = src
 		opts = c.Options()
 	}
 
-	m, err := jspacker.Package(opts...)
+	meta := c.meta
+
+	m, err := c.packageModule(opts)
 	if err != nil {
-		return fmt.Errorf("error generating output: %w", err)
+		return err
+	}
+
+	if meta != nil {
+		c.meta.Modules = append(meta.Modules, c.meta.Modules...)
 	}
 
 	if err = c.writeOutput(w, m); err != nil {
@@ -148,7 +171,7 @@ func (c *Config) processScript(w io.Writer, html string, script tag) error {
 }
 
 func (c *Config) processStyle(w io.Writer, html string, tag tag) error {
-	return c.processCSSData(w, cssLoader{base: c.base, path: "/", source: html[tag.contentStart:tag.contentEnd]})
+	return c.processCSSData(w, c.watchCSS(cssLoader{base: c.base, path: "/", source: html[tag.contentStart:tag.contentEnd]}))
 }
 
 func (c *Config) processCSSData(w io.Writer, cs CSSLoader) error {
@@ -172,7 +195,7 @@ func (c *Config) processCSSData(w io.Writer, cs CSSLoader) error {
 }
 
 func (c *Config) processLink(w io.Writer, tag tag) error {
-	return c.processCSSData(w, (cssLoader{base: c.base, path: c.html}).Resolve(tag.src))
+	return c.processCSSData(w, c.watchCSS(cssLoader{base: c.base, path: c.html}).Resolve(tag.src))
 }
 
 type htmlState struct {
@@ -341,12 +364,12 @@ type tag struct {
 	src                                        string
 }
 
-func scriptLoader(src, base string, jsx *template.Template) func(string) (*javascript.Module, error) {
-	loader := jspacker.OSLoad(base, jsxLoadOpt(jsx)...)
+func scriptLoader(src, base string, jsx *template.Template, opts ...jspacker.LoadOpt) func(string, string) (*javascript.Module, error) {
+	loader := jspacker.OSTypedLoad(base, append(jsxLoadOpt(jsx), opts...)...)
 
-	return func(file string) (*javascript.Module, error) {
+	return func(file, typ string) (*javascript.Module, error) {
 		if file != "/\x00" {
-			return loader(file)
+			return loader(file, typ)
 		}
 
 		tk := parser.NewStringTokeniser(src)
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"vimagination.zapto.org/jspacker"
 )
 
 func TestProcessHTMLInput(t *testing.T) {
@@ -144,7 +148,7 @@ func TestProcessHTMLInput(t *testing.T) {
 		c := Config{
 			filesTodo:  []string{"/index.html"},
 			base:       tmp,
-			importMap:  make(ImportMap),
+			importMap:  newImportMap(),
 			noExports:  true,
 			processCSS: true,
 		}
@@ -167,13 +171,61 @@ func TestScriptLoader(t *testing.T) {
 
 	if err := os.WriteFile(filepath.Join(tmp, "a.js"), []byte("a;"), 0600); err != nil {
 		t.Fatalf("unexpected error: %v", err)
-	} else if m, err := fn("a.js"); err != nil {
+	} else if m, err := fn("a.js", ""); err != nil {
 		t.Errorf("test 1: unexpected error: %v", err)
 	} else if str := fmt.Sprintf("%+s", m); str != "a;" {
 		t.Errorf("test 2: expecting string %q, got %q", "a;", str)
-	} else if m, err = fn("/\x00"); err != nil {
+	} else if m, err = fn("/\x00", ""); err != nil {
 		t.Errorf("test 3: unexpected error: %v", err)
 	} else if str = fmt.Sprintf("%+s", m); str != "b;" {
 		t.Errorf("test 4: expecting string %q, got %q", "b;", str)
 	}
 }
+
+func TestProcessHTMLMetafile(t *testing.T) {
+	tmp := t.TempDir()
+
+	for file, data := range map[string]string{
+		"index.html": `<html><head><script type="module" src="a.js"></script><script type="module" src="b.js"></script></head></html>`,
+		"a.js":       "a;",
+		"b.js":       "b;",
+	} {
+		if err := os.WriteFile(filepath.Join(tmp, file), []byte(data), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	c := Config{
+		filesTodo: []string{"/index.html"},
+		base:      tmp,
+		output:    filepath.Join(tmp, "out.html"),
+		metafile:  filepath.Join(tmp, "meta.json"),
+		importMap: newImportMap(),
+		noExports: true,
+	}
+
+	if err := c.processHTML(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(c.metafile)
+	if err != nil {
+		t.Fatalf("unexpected error reading metafile: %v", err)
+	}
+
+	var meta jspacker.Metafile
+
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("unexpected error decoding metafile: %v", err)
+	}
+
+	var urls []string
+
+	for _, m := range meta.Modules {
+		urls = append(urls, m.URL)
+	}
+
+	if expected := []string{"/a.js", "/b.js"}; !slices.Equal(urls, expected) {
+		t.Errorf("expecting modules %v, got %v", expected, urls)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +16,15 @@ import (
 )
 
 func (c *Config) processJavascript() error {
+	s, err := c.buildJavascript()
+	if err != nil {
+		return err
+	}
+
+	return c.outputJS(s)
+}
+
+func (c *Config) buildJavascript() (*javascript.Module, error) {
 	var (
 		s   *javascript.Module
 		err error
@@ -20,17 +32,17 @@ func (c *Config) processJavascript() error {
 
 	if c.plugin {
 		if s, err = readPlugin(c.base, c.filesTodo[0]); err != nil {
-			return err
+			return nil, err
 		}
 	} else if s, err = c.readModuleWithOptions(); err != nil {
-		return err
+		return nil, err
 	}
 
 	for len(s.ModuleListItems) > 0 && s.ModuleListItems[0].ImportDeclaration == nil && s.ModuleListItems[0].ExportDeclaration == nil && s.ModuleListItems[0].StatementListItem == nil {
 		s.ModuleListItems = s.ModuleListItems[1:]
 	}
 
-	return c.outputJS(s)
+	return s, nil
 }
 
 func readPlugin(base, input string) (*javascript.Module, error) {
@@ -56,18 +68,67 @@ func readPlugin(base, input string) (*javascript.Module, error) {
 }
 
 func (c *Config) readModuleWithOptions() (*javascript.Module, error) {
-	s, err := jspacker.Package(c.Options()...)
+	s, err := c.packageModule(c.Options())
+	if err != nil {
+		return nil, err
+	} else if err := c.writeMetafile(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (c *Config) packageModule(opts []jspacker.Option) (*javascript.Module, error) {
+	c.chunks = nil
+
+	s, err := jspacker.Package(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error generating output: %w", err)
+	} else if c.splitErr != nil {
+		return nil, fmt.Errorf("error writing chunk: %w", c.splitErr)
+	} else if err := c.writeHashedChunks(s); err != nil {
+		return nil, fmt.Errorf("error writing chunk: %w", err)
 	}
 
 	return s, nil
 }
 
+func (c *Config) writeMetafile() error {
+	if c.meta == nil {
+		return nil
+	} else if c.report != "" {
+		if err := c.writeReport(); err != nil {
+			return err
+		}
+	}
+
+	if c.metafile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.meta, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding metafile: %w", err)
+	}
+
+	if err := os.WriteFile(c.metafile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing metafile: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Config) outputJS(s *javascript.Module) (err error) {
 	f, err := c.outputFile()
+	if err != nil {
+		return err
+	}
 
 	defer func() {
+		if err != nil {
+			abortOutput(f)
+		}
+
 		if errr := f.Close(); err == nil && errr != nil {
 			err = fmt.Errorf("error closing output: %w", errr)
 		}
@@ -77,6 +138,10 @@ func (c *Config) outputJS(s *javascript.Module) (err error) {
 }
 
 func (c *Config) writeOutput(w io.Writer, m *javascript.Module) (err error) {
+	if c.sources != nil {
+		return c.writeOutputWithSourceMap(w, m)
+	}
+
 	if len(c.minifier) > 0 {
 		pr, pw, errr := os.Pipe()
 		if err != nil {
@@ -101,9 +166,103 @@ func (c *Config) writeOutput(w io.Writer, m *javascript.Module) (err error) {
 		defer pw.Close()
 	}
 
-	if _, err = fmt.Fprintf(w, "%+s\n", m); err != nil {
+	if c.minify {
+		err = printMinified(w, m)
+	} else {
+		_, err = fmt.Fprintf(w, "%+s\n", m)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing to output: %w", err)
+	}
+
+	return nil
+}
+
+func printMinified(w io.Writer, m *javascript.Module) error {
+	if err := jspacker.PrintMinified(w, m); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+func (c *Config) writeOutputWithSourceMap(w io.Writer, m *javascript.Module) error {
+	output := fmt.Sprintf("%+s", m)
+
+	sm, err := c.sources.Generate(filepath.Base(c.output), output)
+	if err != nil {
+		return fmt.Errorf("error generating source map: %w", err)
+	}
+
+	var ref string
+
+	if c.output == "-" || c.processHTMLFile {
+		ref = "data:application/json;base64," + base64.StdEncoding.EncodeToString(sm)
+	} else if c.hash {
+		if ref, err = writeHashed(c.output+".map", sm); err != nil {
+			return fmt.Errorf("error writing source map: %w", err)
+		}
+	} else if err := os.WriteFile(c.output+".map", sm, 0644); err != nil {
+		return fmt.Errorf("error writing source map: %w", err)
+	} else {
+		ref = filepath.Base(c.output) + ".map"
+	}
+
+	if _, err := fmt.Fprintf(w, "%s\n//# sourceMappingURL=%s\n", output, ref); err != nil {
 		return fmt.Errorf("error writing to output: %w", err)
 	}
 
 	return nil
 }
+
+func (c *Config) writeChunk(url string, m *javascript.Module) {
+	if c.splitErr != nil {
+		return
+	} else if c.hash {
+		c.chunks = append(c.chunks, chunkFile{url: url, module: m})
+	} else {
+		c.splitErr = c.writeChunkFile(url, url, m)
+	}
+}
+
+// writeChunkFile writes the chunk with the given URL to the named file,
+// along with its source map when one is being generated.
+func (c *Config) writeChunkFile(url, name string, m *javascript.Module) error {
+	var buf bytes.Buffer
+
+	if err := c.printChunk(&buf, m); err != nil {
+		return err
+	}
+
+	file := filepath.Join(c.base, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	if c.sources != nil {
+		sm, err := c.sources.GenerateChunk(url, filepath.Base(file), buf.String())
+		if err != nil {
+			return fmt.Errorf("error generating source map: %w", err)
+		} else if err := os.WriteFile(file+".map", sm, 0644); err != nil {
+			return fmt.Errorf("error writing source map: %w", err)
+		}
+
+		fmt.Fprintf(&buf, "//# sourceMappingURL=%s.map\n", filepath.Base(file))
+	}
+
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+func (c *Config) printChunk(w io.Writer, m *javascript.Module) error {
+	if c.minify {
+		return printMinified(w, m)
+	}
+
+	_, err := fmt.Fprintf(w, "%+s\n", m)
+
+	return err
+}
@@ -8,10 +8,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"maps"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -19,12 +20,21 @@ import (
 )
 
 type Config struct {
-	output, base, html                                                             string
+	output, base, html, splitDir, addr, globalName, metafile, report, graph        string
 	filesTodo                                                                      Inputs
 	plugin, noExports, exports, processHTMLFile, processCSS, minimiseCSS, compress bool
-	importMap                                                                      ImportMap
+	sourceMap, watch, node, hash, minify, warnings                                 bool
+	importMap                                                                      *ImportMap
+	assetTypes                                                                     AssetTypes
+	format                                                                         jspacker.OutputFormat
 	minifier                                                                       Minifier
 	jsx                                                                            *template.Template
+	sources                                                                        *jspacker.SourceMapper
+	meta                                                                           *jspacker.Metafile
+	splitErr                                                                       error
+	chunks                                                                         []chunkFile
+	watched                                                                        *watchList
+	cache                                                                          *jspacker.Cache
 }
 
 type Inputs []string
@@ -45,9 +55,15 @@ func main() {
 	}
 }
 
-type ImportMap map[string]string
+type ImportMap struct {
+	jspacker.ImportMap
+}
+
+func newImportMap() *ImportMap {
+	return &ImportMap{ImportMap: jspacker.ImportMap{Imports: make(map[string]string)}}
+}
 
-func (i ImportMap) Set(v string) error {
+func (i *ImportMap) Set(v string) error {
 	if v == "-" {
 		return i.Import(os.Stdin)
 	} else if strings.HasPrefix(v, "@") {
@@ -56,7 +72,7 @@ func (i ImportMap) Set(v string) error {
 			return ErrInvalidImportMapping
 		}
 
-		i[k] = v
+		i.Imports[k] = v
 	} else {
 		f, err := os.Open(v)
 		if err != nil {
@@ -73,32 +89,76 @@ func (i ImportMap) Set(v string) error {
 	return nil
 }
 
-func (i ImportMap) Import(r io.Reader) error {
-	var im struct {
-		Imports map[string]string
+type importMapFlag struct {
+	*ImportMap
+	watched *watchList
+}
+
+func (i importMapFlag) Set(v string) error {
+	if v != "-" && !strings.HasPrefix(v, "@") {
+		i.watched.add(v)
 	}
 
+	return i.ImportMap.Set(v)
+}
+
+func (i *ImportMap) Import(r io.Reader) error {
+	var im jspacker.ImportMap
+
 	if err := json.NewDecoder(r).Decode(&im); err != nil {
 		return err
 	}
 
-	maps.Copy(i, im.Imports)
+	i.Merge(&im)
 
 	return nil
 }
 
-func (i ImportMap) String() string {
-	b, _ := json.Marshal(i)
+func (i *ImportMap) String() string {
+	if i == nil {
+		return "null"
+	}
+
+	b, _ := json.Marshal(i.Imports)
 
 	return string(b)
 }
 
-func (i ImportMap) Resolve(from, to string) string {
-	if m, ok := i[to]; ok {
-		return jspacker.RelTo("/", m)
+func (i *ImportMap) Resolve(from, to string) (string, error) {
+	return i.Resolver(func(from, to string) (string, error) {
+		return jspacker.RelTo(from, to), nil
+	})(from, to)
+}
+
+func (i *ImportMap) empty() bool {
+	return len(i.Imports) == 0 && len(i.Scopes) == 0
+}
+
+type AssetTypes map[string]string
+
+var assetTypeNames = []string{"json", "text", "bytes", "dataurl"}
+
+func (a *AssetTypes) Set(v string) error {
+	ext, typ, ok := strings.Cut(v, "=")
+	if !ok || !strings.HasPrefix(ext, ".") {
+		return ErrInvalidAssetType
+	} else if !slices.Contains(assetTypeNames, typ) {
+		return fmt.Errorf("%w: %s", ErrUnknownAssetType, typ)
+	}
+
+	if *a == nil {
+		*a = make(AssetTypes)
 	}
 
-	return jspacker.RelTo(from, to)
+	(*a)[ext] = typ
+
+	return nil
+}
+
+func (a *AssetTypes) String() string {
+	b, _ := json.Marshal(a)
+
+	return string(b)
 }
 
 type Minifier []string
@@ -125,43 +185,123 @@ type htmlPage struct {
 }
 
 func run() error {
-	c, err := parseConfig()
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		return serve(os.Args[2:])
+	}
+
+	c, err := parseConfig(os.Args[1:], nil)
 	if err != nil {
 		return err
 	}
 
-	if c.processHTMLFile {
+	if c.watch {
+		return watchBuild(os.Args[1:])
+	}
+
+	return c.build()
+}
+
+func (c *Config) build() error {
+	if c.graph != "" {
+		return c.writeGraph()
+	} else if c.processHTMLFile {
 		return c.processHTML()
 	}
 
 	return c.processJavascript()
 }
 
-func parseConfig() (*Config, error) {
-	var jsx string
+func (c *Config) clone() *Config {
+	d := *c
+	d.importMap = newImportMap()
+	d.filesTodo = slices.Clone(c.filesTodo)
+
+	d.importMap.Merge(&c.importMap.ImportMap)
+
+	return &d
+}
+
+var formats = map[string]jspacker.OutputFormat{
+	"esm":  jspacker.FormatESM,
+	"iife": jspacker.FormatIIFE,
+	"cjs":  jspacker.FormatCJS,
+	"umd":  jspacker.FormatUMD,
+}
 
-	config := &Config{importMap: make(ImportMap)}
+func parseConfig(args []string, watched *watchList) (*Config, error) {
+	var jsx, format string
 
-	flag.Var(&config.filesTodo, "i", "input file")
-	flag.StringVar(&config.output, "o", "-", "output file")
-	flag.StringVar(&config.base, "b", "", "base dir")
-	flag.BoolVar(&config.plugin, "p", false, "export file as plugin")
-	flag.BoolVar(&config.noExports, "n", false, "no exports")
-	flag.BoolVar(&config.exports, "e", false, "keep primary file exports")
-	flag.BoolVar(&config.processHTMLFile, "P", false, "process input file as HTML, packing JavaScript sources in-place (implies -H with the input file)")
-	flag.BoolVar(&config.processCSS, "c", false, "embed linked CSS in HTML file")
-	flag.BoolVar(&config.minimiseCSS, "C", false, "minimise embedded CSS")
-	flag.Var(config.importMap, "m", "import map used to resolve import URLs; can be specified as a JSON file or as individual KEY=VALUE pairs")
-	flag.StringVar(&config.html, "H", "", "parse import map from HTML file")
-	flag.Var(&config.minifier, "M", "minifier to pass code through, specified as JSON array of command words; e.g [\"terser\", \"-m\"]")
-	flag.BoolVar(&config.compress, "z", false, "gzip compress output")
-	flag.StringVar(&jsx, "x", "", "JSX processing template")
-	flag.Parse()
+	config := &Config{importMap: newImportMap(), watched: watched}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	if watched != nil {
+		fs.Init(os.Args[0], flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+	}
+
+	fs.Var(&config.filesTodo, "i", "input file")
+	fs.StringVar(&config.output, "o", "-", "output file")
+	fs.StringVar(&config.base, "b", "", "base dir")
+	fs.BoolVar(&config.plugin, "p", false, "export file as plugin")
+	fs.BoolVar(&config.noExports, "n", false, "no exports")
+	fs.BoolVar(&config.node, "node", false, "resolve bare import specifiers from node_modules directories in the base dir")
+	fs.BoolVar(&config.exports, "e", false, "keep primary file exports")
+	fs.BoolVar(&config.processHTMLFile, "P", false, "process input file as HTML, packing JavaScript sources in-place (implies -H with the input file)")
+	fs.BoolVar(&config.processCSS, "c", false, "embed linked CSS in HTML file")
+	fs.BoolVar(&config.minimiseCSS, "C", false, "minimise embedded CSS")
+	fs.Var(importMapFlag{ImportMap: config.importMap, watched: watched}, "m", "import map used to resolve import URLs; can be specified as a JSON file or as individual KEY=VALUE pairs")
+	fs.StringVar(&config.html, "H", "", "parse import map from HTML file")
+	fs.Var(&config.assetTypes, "t", "load files with the given extension as assets, specified as EXT=TYPE pairs; e.g. .svg=text. TYPE can be one of json, text, bytes, or dataurl")
+	fs.Var(&config.minifier, "M", "minifier to pass code through, specified as JSON array of command words; e.g [\"terser\", \"-m\"]")
+	fs.BoolVar(&config.minify, "minify", false, "minify the output with the built-in minifier")
+	fs.BoolVar(&config.compress, "z", false, "gzip compress output")
+	fs.StringVar(&jsx, "x", "", "JSX processing template")
+	fs.StringVar(&format, "f", "esm", "output format; one of esm, iife, cjs, or umd")
+	fs.StringVar(&config.globalName, "g", "", "global name to assign primary file exports to, for iife and umd formats")
+	fs.StringVar(&config.splitDir, "split", "", "split dynamically imported modules into chunk files, written to the given directory, relative to the base dir")
+	fs.StringVar(&config.metafile, "metafile", "", "write a JSON description of the packaged modules, their sizes, imports, and exports to the given file")
+	fs.StringVar(&config.report, "report", "", "write an HTML treemap of the raw and gzipped size of each packaged module to the given file")
+	fs.StringVar(&config.graph, "graph", "", "write the import graph of the input files to the output, instead of bundling them; one of dot or json")
+	fs.StringVar(&config.addr, "l", "localhost:8080", "listen address for serve mode")
+	fs.BoolVar(&config.watch, "w", false, "watch all loaded files, rebuilding the output when they change")
+	fs.BoolVar(&config.hash, "hash", false, "add a hash of the output contents to the output filename, recording the name in a manifest.json file in the output directory")
+	fs.BoolVar(&config.sourceMap, "sourcemap", false, "generate a source map for the output, and any split chunks; written alongside each file, or inlined when writing to stdout or HTML")
+	fs.BoolVar(&config.warnings, "warnings", false, "print warnings about suspicious constructs, such as unused imports, to stderr")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
 	if config.plugin && len(config.filesTodo) != 1 {
 		return nil, errors.New("plugin mode requires a single file")
 	}
 
+	if config.hash && (config.output == "-" || config.output == "") {
+		return nil, errors.New("hashed output requires an output file")
+	}
+
+	if config.watch && (config.output == "-" || slices.Contains(config.filesTodo, "-") || slices.Contains(args, "-")) {
+		return nil, errors.New("watch mode requires an output file, and cannot read from stdin")
+	}
+
+	if config.graph != "" && config.graph != "dot" && config.graph != "json" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGraphFormat, config.graph)
+	} else if config.graph != "" && (config.plugin || config.processHTMLFile) {
+		return nil, errors.New("graph mode cannot be used with plugin or HTML processing")
+	}
+
+	f, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, format)
+	}
+
+	config.format = f
+
+	if config.sourceMap && len(config.minifier) > 0 {
+		return nil, errors.New("source maps cannot be generated when using an external minifier")
+	} else if config.minify && (config.sourceMap || len(config.minifier) > 0) {
+		return nil, errors.New("the built-in minifier cannot be used with source maps or an external minifier")
+	}
+
 	if err := config.setPaths(); err != nil {
 		return nil, err
 	}
@@ -215,6 +355,8 @@ func (c *Config) setPaths() error {
 }
 
 func (c *Config) readImportsFromHTML() error {
+	c.watched.add(c.html)
+
 	f, err := os.Open(c.html)
 	if err != nil {
 		return err
@@ -245,15 +387,44 @@ func (c *Config) readImportsFromHTML() error {
 }
 
 func (c *Config) Options() []jspacker.Option {
-	options := make([]jspacker.Option, 1, len(c.filesTodo)+4)
+	options := make([]jspacker.Option, 2, len(c.filesTodo)+7)
 	options[0] = jspacker.ParseDynamic
+	options[1] = jspacker.Workers(runtime.GOMAXPROCS(0))
+
+	if c.warnings {
+		options = append(options, jspacker.Warnings(printWarning))
+	}
+
+	if c.node {
+		options = append(options, jspacker.ResolveURLWithError(c.importMap.Resolver(jspacker.NodeResolver(os.DirFS(c.base)))))
+	} else if !c.importMap.empty() {
+		options = append(options, jspacker.ResolveURLWithError(c.importMap.Resolve))
+	}
+
+	if c.cache != nil {
+		options = append(options, jspacker.UseCache(c.cache))
+	}
 
-	if len(c.importMap) > 0 {
-		options = append(options, jspacker.ResolveURL(c.importMap.Resolve))
+	if c.metafile != "" || c.report != "" {
+		c.meta = new(jspacker.Metafile)
+		options = append(options, jspacker.Metadata(c.meta))
+	}
+
+	if c.minify {
+		options = append(options, jspacker.Minify)
+	}
+
+	if c.sourceMap {
+		c.sources = new(jspacker.SourceMapper)
+		options = append(options, jspacker.SourceMap(c.sources))
+	}
+
+	if c.splitDir != "" {
+		options = append(options, jspacker.SplitDynamic(path.Join("/", filepath.ToSlash(c.splitDir)), c.writeChunk))
 	}
 
 	if c.base != "" {
-		options = append(options, jspacker.Loader(jspacker.OSLoad(c.base, jsxLoadOpt(c.jsx)...)))
+		options = append(options, jspacker.TypedLoader(c.cssModules(jspacker.OSTypedLoad(c.base, c.loadOpts()...))))
 	}
 
 	if c.noExports {
@@ -264,6 +435,10 @@ func (c *Config) Options() []jspacker.Option {
 		options = append(options, jspacker.PrimaryExports)
 	}
 
+	if c.format != jspacker.FormatESM {
+		options = append(options, jspacker.Format(c.format, c.globalName))
+	}
+
 	for _, f := range c.filesTodo {
 		options = append(options, jspacker.File(f))
 	}
@@ -271,6 +446,38 @@ func (c *Config) Options() []jspacker.Option {
 	return options
 }
 
+func printWarning(w jspacker.Warning) {
+	fmt.Fprintln(os.Stderr, "warning:", w)
+}
+
+func (c *Config) loadOpts() []jspacker.LoadOpt {
+	return append(append(jsxLoadOpt(c.jsx), c.sourceNameOpts()...), c.assetTypeOpts()...)
+}
+
+func (c *Config) assetTypeOpts() []jspacker.LoadOpt {
+	if len(c.assetTypes) == 0 {
+		return nil
+	}
+
+	return []jspacker.LoadOpt{jspacker.ExtensionTypes(c.assetTypes)}
+}
+
+func (c *Config) sourceNameOpts() []jspacker.LoadOpt {
+	if c.sources == nil && c.watched == nil {
+		return nil
+	}
+
+	return []jspacker.LoadOpt{jspacker.SourceNames(c.sourceName)}
+}
+
+func (c *Config) sourceName(url, source string) {
+	if c.sources != nil {
+		c.sources.SetSource(url, source)
+	}
+
+	c.watched.add(filepath.Join(c.base, filepath.FromSlash(source)))
+}
+
 func jsxLoadOpt(jsx *template.Template) []jspacker.LoadOpt {
 	if jsx == nil {
 		return []jspacker.LoadOpt{}
@@ -284,9 +491,17 @@ func (c *Config) outputFile() (io.WriteCloser, error) {
 		return os.Stdout, nil
 	}
 
-	f, err := os.Create(c.output)
-	if err != nil {
-		return nil, fmt.Errorf("error creating output file: %w", err)
+	var f io.WriteCloser
+
+	if c.hash {
+		f = &hashedFile{output: c.output}
+	} else {
+		of, err := os.Create(c.output)
+		if err != nil {
+			return nil, fmt.Errorf("error creating output file: %w", err)
+		}
+
+		f = of
 	}
 
 	if !c.compress {
@@ -306,7 +521,11 @@ func (c *Config) outputFile() (io.WriteCloser, error) {
 
 type compressedFile struct {
 	*gzip.Writer
-	file *os.File
+	file io.WriteCloser
+}
+
+func (c *compressedFile) Abort() {
+	abortOutput(c.file)
 }
 
 func (c *compressedFile) Close() (err error) {
@@ -319,4 +538,10 @@ func (c *compressedFile) Close() (err error) {
 	return c.Writer.Close()
 }
 
-var ErrInvalidImportMapping = errors.New("invalid import mapping")
+var (
+	ErrInvalidImportMapping = errors.New("invalid import mapping")
+	ErrInvalidAssetType     = errors.New("invalid asset type, must be EXT=TYPE")
+	ErrInvalidFormat        = errors.New("invalid output format")
+	ErrInvalidGraphFormat   = errors.New("invalid graph format")
+	ErrUnknownAssetType     = errors.New("unknown asset type, must be one of json, text, bytes, or dataurl")
+)
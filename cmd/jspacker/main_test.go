@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConfigClone(t *testing.T) {
+	c := &Config{importMap: newImportMap(), filesTodo: Inputs{"/a.js", "/b.js"}}
+	c.importMap.Imports["a"] = "/a.js"
+
+	d := c.clone()
+	d.filesTodo[0] = "/c.js"
+	d.importMap.Imports["b"] = "/b.js"
+
+	if c.filesTodo[0] != "/a.js" {
+		t.Errorf("expecting original inputs to be unchanged, got %v", c.filesTodo)
+	}
+
+	if _, ok := c.importMap.Imports["b"]; ok {
+		t.Errorf("expecting original import map to be unchanged, got %v", c.importMap.Imports)
+	} else if d.importMap.Imports["a"] != "/a.js" {
+		t.Errorf("expecting cloned import map to contain original imports, got %v", d.importMap.Imports)
+	}
+}
+
+func TestAssetTypesSet(t *testing.T) {
+	for n, test := range [...]struct {
+		Input string
+		Err   error
+	}{
+		{ // 1
+			".svg=text", nil,
+		},
+		{ // 2
+			".png=dataurl", nil,
+		},
+		{ // 3
+			"svg=text", ErrInvalidAssetType,
+		},
+		{ // 4
+			".svg", ErrInvalidAssetType,
+		},
+		{ // 5
+			".svg=txt", ErrUnknownAssetType,
+		},
+	} {
+		var a AssetTypes
+
+		if err := a.Set(test.Input); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+	}
+}
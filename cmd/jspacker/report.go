@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+)
+
+func (c *Config) writeReport() error {
+	f, err := os.Create(c.report)
+	if err != nil {
+		return fmt.Errorf("error creating report: %w", err)
+	}
+
+	if err := reportTemplate.Execute(f, c.meta); err != nil {
+		f.Close()
+
+		return fmt.Errorf("error writing report: %w", err)
+	}
+
+	return f.Close()
+}
+
+var reportTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="utf-8">
+		<title>Bundle Size Report</title>
+		<style type="text/css">
+body {
+	margin: 0;
+	font-family: sans-serif;
+	display: flex;
+	flex-direction: column;
+	height: 100vh;
+}
+
+header {
+	padding: 0.5em 1em;
+	display: flex;
+	gap: 1em;
+	align-items: center;
+	border-bottom: 1px solid #888;
+}
+
+#map {
+	position: relative;
+	flex-grow: 1;
+	overflow: hidden;
+}
+
+.node {
+	position: absolute;
+	box-sizing: border-box;
+	border: 1px solid #fff;
+	overflow: hidden;
+	font-size: 12px;
+	padding: 2px;
+	white-space: nowrap;
+	text-overflow: ellipsis;
+}
+
+.dir {
+	background-color: #ddd;
+	font-weight: bold;
+}
+
+.file {
+	background-color: #9cf;
+}
+
+.file:hover {
+	background-color: #fc9;
+}
+		</style>
+	</head>
+	<body>
+		<header>
+			<strong>Bundle Size Report</strong>
+			<label><input type="radio" name="size" value="bytes" checked> Raw</label>
+			<label><input type="radio" name="size" value="gzipBytes"> Gzip</label>
+			<span id="total"></span>
+		</header>
+		<div id="map"></div>
+		<script type="module">
+const modules = {{.Modules}},
+      map = document.getElementById("map"),
+      total = document.getElementById("total"),
+      label = 16,
+      formatSize = size => size < 1024 ? size + " B" : (size / 1024).toFixed(1) + " KiB",
+      tree = key => {
+	const root = {name: "/", size: 0, children: new Map()};
+
+	for (const m of modules) {
+		const parts = m.url.split("/").filter(p => p),
+		      file = parts.pop() ?? m.url;
+
+		let node = root;
+
+		root.size += m[key];
+
+		for (const part of parts) {
+			if (!node.children.has(part)) {
+				node.children.set(part, {name: part + "/", size: 0, children: new Map()});
+			}
+
+			node = node.children.get(part);
+			node.size += m[key];
+		}
+
+		node.children.set(file, {name: file, size: m[key], module: m});
+	}
+
+	return root;
+      },
+      layout = (node, x, y, w, h, path) => {
+	const children = Array.from(node.children.values()).filter(c => c.size > 0).sort((a, b) => b.size - a.size),
+	      horizontal = w >= h;
+
+	let offset = 0;
+
+	for (const child of children) {
+		const span = (horizontal ? w : h) * child.size / node.size,
+		      el = map.appendChild(document.createElement("div")),
+		      [cx, cy, cw, ch] = horizontal ? [x + offset, y, span, h] : [x, y + offset, w, span];
+
+		el.className = "node " + (child.module ? "file" : "dir");
+		el.style.left = cx + "px";
+		el.style.top = cy + "px";
+		el.style.width = cw + "px";
+		el.style.height = ch + "px";
+		el.textContent = child.name;
+		el.title = path + child.name + "\n" + formatSize(child.size) + (child.module ? "\nprefix: " + child.module.prefix : "");
+
+		if (child.children && cw > 4 && ch > label + 4) {
+			layout(child, cx + 2, cy + label, cw - 4, ch - label - 2, path + child.name);
+		}
+
+		offset += span;
+	}
+      },
+      draw = () => {
+	const key = document.querySelector("input[name=size]:checked").value,
+	      root = tree(key);
+
+	map.replaceChildren();
+	total.textContent = "Total: " + formatSize(root.size);
+
+	if (root.size > 0) {
+		layout(root, 0, 0, map.clientWidth, map.clientHeight, "/");
+	}
+      };
+
+for (const input of document.querySelectorAll("input[name=size]")) {
+	input.addEventListener("change", draw);
+}
+
+window.addEventListener("resize", draw);
+
+draw();
+		</script>
+	</body>
+</html>
+`))
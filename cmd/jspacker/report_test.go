@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/jspacker"
+)
+
+func TestWriteReport(t *testing.T) {
+	c := Config{
+		report: filepath.Join(t.TempDir(), "report.html"),
+		meta: &jspacker.Metafile{
+			Modules: []jspacker.MetaModule{
+				{URL: "/main.js", Prefix: "a_", Bytes: 100, GzipBytes: 50},
+				{URL: "/lib/</script>.js", Prefix: "b_", Bytes: 20, GzipBytes: 10},
+			},
+		},
+	}
+
+	if err := c.writeReport(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(c.report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := string(data)
+
+	if !strings.Contains(report, `"url":"/main.js"`) {
+		t.Errorf("expecting report to contain module data")
+	} else if strings.Count(report, "</script>") != 1 {
+		t.Errorf("expecting module URLs to be escaped")
+	}
+}
+
+func TestProcessHTMLReport(t *testing.T) {
+	tmp := t.TempDir()
+
+	for file, data := range map[string]string{
+		"index.html": `<html><head><script type="module" src="a.js"></script><script type="module" src="b.js"></script></head></html>`,
+		"a.js":       "a;",
+		"b.js":       "b;",
+	} {
+		if err := os.WriteFile(filepath.Join(tmp, file), []byte(data), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	c := Config{
+		filesTodo: []string{"/index.html"},
+		base:      tmp,
+		output:    filepath.Join(tmp, "out.html"),
+		report:    filepath.Join(tmp, "report.html"),
+		importMap: newImportMap(),
+		noExports: true,
+	}
+
+	if err := c.processHTML(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(c.report)
+	if err != nil {
+		t.Fatalf("unexpected error reading report: %v", err)
+	}
+
+	for _, url := range [...]string{"/a.js", "/b.js"} {
+		if !strings.Contains(string(data), `"url":"`+url+`"`) {
+			t.Errorf("expecting report to contain module %s", url)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vimagination.zapto.org/jspacker"
+)
+
+const (
+	eventsPath   = "/__jspacker/events"
+	reloadClient = `<script type="module">
+(() => {
+	let id = "";
+
+	new EventSource(%q).addEventListener("message", e => {
+		if (e.data === "reload" || id && id !== e.data) {
+			location.reload();
+		}
+
+		id = e.data;
+	});
+})();
+</script>
+`
+)
+
+type server struct {
+	args    []string
+	config  *Config
+	base    string
+	id      string
+	watched *watchList
+	cache   *jspacker.Cache
+	files   http.Handler
+	watcher *watcher
+
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func serve(args []string) error {
+	watched := new(watchList)
+
+	c, err := parseConfig(args, watched)
+	if err != nil {
+		return err
+	}
+
+	w, err := newWatcher()
+	if err != nil {
+		return fmt.Errorf("error starting file watcher: %w", err)
+	}
+
+	defer w.Close()
+
+	s := &server{
+		args:    args,
+		config:  c,
+		base:    c.base,
+		id:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		watched: watched,
+		cache:   jspacker.NewCache(uncachedCSS(jspacker.FileKey(c.base, jsxLoadOpt(c.jsx)...))),
+		files:   http.FileServer(http.Dir(c.base)),
+		watcher: w,
+		clients: make(map[chan struct{}]struct{}),
+	}
+
+	s.watch()
+
+	go s.reloadOnChange()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(eventsPath, s.events)
+	mux.Handle("/", s)
+
+	fmt.Fprintf(os.Stderr, "serving %s on http://%s/\n", c.base, c.addr)
+
+	return http.ListenAndServe(c.addr, mux)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer s.watch()
+
+	s.mu.Lock()
+	c := s.config.clone()
+	s.mu.Unlock()
+
+	c.cache = s.cache
+	urlPath := r.URL.Path
+
+	if strings.HasSuffix(urlPath, "/") {
+		urlPath += "index.html"
+	}
+
+	for _, input := range c.filesTodo {
+		if path.Clean("/"+filepath.ToSlash(input)) != urlPath {
+			continue
+		}
+
+		c.filesTodo = Inputs{input}
+
+		if c.processHTMLFile {
+			s.serveHTML(w, c)
+		} else {
+			s.serveJavascript(w, c)
+		}
+
+		return
+	}
+
+	s.serveFile(w, r, urlPath)
+}
+
+func (s *server) serveHTML(w http.ResponseWriter, c *Config) {
+	h, err := c.processHTMLInput()
+	if err != nil {
+		s.writeError(w, true, err)
+
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := c.writeHTML(&buf, h); err != nil {
+		s.writeError(w, true, err)
+
+		return
+	}
+
+	s.writeHTML(w, buf.Bytes())
+}
+
+func (s *server) serveJavascript(w http.ResponseWriter, c *Config) {
+	m, err := c.buildJavascript()
+	if err != nil {
+		s.writeError(w, false, err)
+
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := c.writeOutput(&buf, m); err != nil {
+		s.writeError(w, false, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+func (s *server) serveFile(w http.ResponseWriter, r *http.Request, urlPath string) {
+	file := filepath.Join(s.base, filepath.FromSlash(path.Clean(urlPath)))
+
+	if strings.HasSuffix(file, ".html") {
+		if data, err := os.ReadFile(file); err == nil {
+			s.watched.add(file)
+			s.writeHTML(w, data)
+
+			return
+		}
+	} else if _, err := os.Stat(file); err == nil {
+		s.watched.add(file)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.files.ServeHTTP(w, r)
+}
+
+func (s *server) writeHTML(w http.ResponseWriter, data []byte) {
+	client := fmt.Sprintf(reloadClient, eventsPath)
+	pos := bytes.LastIndex(bytes.ToLower(data), []byte("</body>"))
+
+	if pos < 0 {
+		pos = len(data)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data[:pos])
+	w.Write([]byte(client))
+	w.Write(data[pos:])
+}
+
+func (s *server) writeError(w http.ResponseWriter, asHTML bool, err error) {
+	fmt.Fprintln(os.Stderr, err)
+
+	if asHTML {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.writeHTML(w, []byte("<!DOCTYPE html>\n<html><body><pre>"+html.EscapeString(err.Error())+"</pre></body></html>"))
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+
+		return
+	}
+
+	reload := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	s.clients[reload] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, reload)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	fmt.Fprintf(w, "retry: 1000\ndata: %s\n\n", s.id)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-reload:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *server) watch() {
+	if !s.watched.flush() {
+		return
+	}
+
+	if err := s.watcher.watch(s.watched.list()); err != nil {
+		fmt.Fprintln(os.Stderr, "error watching files:", err)
+	}
+}
+
+func (s *server) reloadOnChange() {
+	for {
+		if err := waitForChange(s.watcher.changes(), s.watched); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return
+		}
+
+		c, err := parseConfig(s.args, s.watched)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		s.mu.Lock()
+
+		if err == nil {
+			s.config = c
+		}
+
+		for client := range s.clients {
+			select {
+			case client <- struct{}{}:
+			default:
+			}
+		}
+
+		s.mu.Unlock()
+		s.watch()
+	}
+}
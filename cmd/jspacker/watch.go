@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const debounce = 100 * time.Millisecond
+
+type watchList struct {
+	mu    sync.Mutex
+	files map[string]struct{}
+	added bool
+}
+
+func (w *watchList) add(file string) {
+	if w == nil {
+		return
+	}
+
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.files == nil {
+		w.files = make(map[string]struct{})
+	}
+
+	if _, ok := w.files[file]; !ok {
+		w.files[file] = struct{}{}
+		w.added = true
+	}
+}
+
+func (w *watchList) flush() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	added := w.added
+	w.added = false
+
+	return added
+}
+
+func (w *watchList) has(file string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.files[file]
+
+	return ok
+}
+
+func (w *watchList) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files := make([]string, 0, len(w.files))
+
+	for file := range w.files {
+		files = append(files, file)
+	}
+
+	slices.Sort(files)
+
+	return files
+}
+
+type watchedCSSLoader struct {
+	cssLoader
+	watched *watchList
+}
+
+func (c *Config) watchCSS(l cssLoader) CSSLoader {
+	if c.watched == nil {
+		return l
+	}
+
+	return watchedCSSLoader{cssLoader: l, watched: c.watched}
+}
+
+func (w watchedCSSLoader) Resolve(path string) CSSLoader {
+	return watchedCSSLoader{cssLoader: w.cssLoader.Resolve(path).(cssLoader), watched: w.watched}
+}
+
+func (w watchedCSSLoader) Open() (io.ReadCloser, error) {
+	if w.source == "" {
+		w.watched.add(filepath.Join(w.base, w.path))
+	}
+
+	return w.cssLoader.Open()
+}
+
+func watchBuild(args []string) error {
+	w, err := newWatcher()
+	if err != nil {
+		return fmt.Errorf("error starting file watcher: %w", err)
+	}
+
+	defer w.Close()
+
+	for {
+		watched := new(watchList)
+
+		if err := buildWatched(args, watched); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			fmt.Fprintln(os.Stderr, "build complete")
+		}
+
+		files := watched.list()
+
+		if len(files) == 0 {
+			return ErrNothingToWatch
+		}
+
+		if err := w.watch(files); err != nil {
+			return fmt.Errorf("error watching files: %w", err)
+		}
+
+		if err := waitForChange(w.changes(), watched); err != nil {
+			return err
+		}
+	}
+}
+
+func buildWatched(args []string, watched *watchList) error {
+	c, err := parseConfig(args, watched)
+	if err != nil {
+		return err
+	}
+
+	return c.build()
+}
+
+func waitForChange(changes <-chan string, watched *watchList) error {
+	for file := range changes {
+		if !watched.has(file) {
+			continue
+		}
+
+		timer := time.NewTimer(debounce)
+
+		for {
+			select {
+			case _, ok := <-changes:
+				if !ok {
+					return ErrWatcherClosed
+				}
+
+				timer.Reset(debounce)
+			case <-timer.C:
+				return nil
+			}
+		}
+	}
+
+	return ErrWatcherClosed
+}
+
+var (
+	ErrNothingToWatch = errors.New("no files to watch")
+	ErrWatcherClosed  = errors.New("file watcher closed")
+)
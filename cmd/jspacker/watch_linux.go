@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+type watcher struct {
+	fd      int
+	mu      sync.Mutex
+	dirs    map[int32]string
+	changed chan string
+}
+
+func newWatcher() (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		fd:      fd,
+		dirs:    make(map[int32]string),
+		changed: make(chan string),
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+func (w *watcher) watch(files []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, file := range files {
+		dir := filepath.Dir(file)
+
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+		if err != nil {
+			return err
+		}
+
+		w.dirs[int32(wd)] = dir
+	}
+
+	return nil
+}
+
+func (w *watcher) read() {
+	defer close(w.changed)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil || n <= 0 {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			w.mu.Lock()
+			dir, ok := w.dirs[event.Wd]
+			w.mu.Unlock()
+
+			if ok && len(name) > 0 {
+				w.changed <- filepath.Join(dir, string(name))
+			}
+		}
+	}
+}
+
+func (w *watcher) changes() <-chan string {
+	return w.changed
+}
+
+func (w *watcher) Close() error {
+	return syscall.Close(w.fd)
+}
@@ -0,0 +1,112 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+const pollInterval = 500 * time.Millisecond
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+type watcher struct {
+	mu      sync.Mutex
+	files   map[string]fileState
+	changed chan string
+	done    chan struct{}
+}
+
+func newWatcher() (*watcher, error) {
+	w := &watcher{
+		files:   make(map[string]fileState),
+		changed: make(chan string),
+		done:    make(chan struct{}),
+	}
+
+	go w.poll()
+
+	return w, nil
+}
+
+func (w *watcher) watch(files []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watching := make(map[string]fileState, len(files))
+
+	for _, file := range files {
+		if state, ok := w.files[file]; ok {
+			watching[file] = state
+		} else {
+			watching[file] = stat(file)
+		}
+	}
+
+	w.files = watching
+
+	return nil
+}
+
+func stat(file string) fileState {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{modTime: fi.ModTime(), size: fi.Size()}
+}
+
+func (w *watcher) poll() {
+	defer close(w.changed)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, file := range w.check() {
+			select {
+			case w.changed <- file:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+func (w *watcher) check() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var changed []string
+
+	for file, state := range w.files {
+		if now := stat(file); now != state {
+			w.files[file] = now
+			changed = append(changed, file)
+		}
+	}
+
+	return changed
+}
+
+func (w *watcher) changes() <-chan string {
+	return w.changed
+}
+
+func (w *watcher) Close() error {
+	close(w.done)
+
+	return nil
+}
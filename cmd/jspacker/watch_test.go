@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestWatchListFlush(t *testing.T) {
+	var w watchList
+
+	for n, test := range [...]struct {
+		Add     []string
+		Flushed bool
+	}{
+		{ // 1
+			nil, false,
+		},
+		{ // 2
+			[]string{"/a.js"}, true,
+		},
+		{ // 3
+			[]string{"/a.js"}, false,
+		},
+		{ // 4
+			[]string{"/a.js", "/b.js"}, true,
+		},
+		{ // 5
+			nil, false,
+		},
+	} {
+		for _, file := range test.Add {
+			w.add(file)
+		}
+
+		if flushed := w.flush(); flushed != test.Flushed {
+			t.Errorf("test %d: expecting flush to return %v, got %v", n+1, test.Flushed, flushed)
+		}
+	}
+}
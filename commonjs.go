@@ -0,0 +1,209 @@
+package jspacker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/javascript/scope"
+	"vimagination.zapto.org/javascript/walk"
+	"vimagination.zapto.org/parser"
+)
+
+const commonJSNamespace = `const %[1]s = new Proxy({}, {
+	get: (_, key) => key === "default" ? %[2]s : %[2]s[key],
+	has: (_, key) => key === "default" || key in Object(%[2]s),
+	ownKeys: () => ["default", ...Reflect.ownKeys(Object(%[2]s))],
+	getOwnPropertyDescriptor: (_, key) => key === "default" || key in Object(%[2]s) ? {value: key === "default" ? %[2]s : %[2]s[key], enumerable: true, configurable: true} : undefined
+});`
+
+func isCommonJS(module *javascript.Module, s *scope.Scope) bool {
+	for _, li := range module.ModuleListItems {
+		if li.StatementListItem == nil {
+			return false
+		}
+	}
+
+	for _, name := range [...]string{"require", "module", "exports"} {
+		if bindings := s.Bindings[name]; len(bindings) > 0 && (bindings[0].BindingType == scope.BindingRef || bindings[0].BindingType == scope.BindingBare) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *dependency) processCommonJS(module *javascript.Module) error {
+	d.cjs = true
+	d.cjsExports = make(map[string]*scope.Binding)
+
+	requires, err := d.findRequires(module)
+	if err != nil {
+		return err
+	}
+
+	var (
+		required     []string
+		refs         = []*javascript.Token{jToken(d.prefix + "module")}
+		params, args = "module, exports", d.prefix + "module, " + d.prefix + "module.exports"
+	)
+
+	for url, e := range sortedMap(requires) {
+		if e.cjs {
+			required = append(required, jsonString(url)+": "+e.prefix+"module.exports")
+			refs = append(refs, jToken(e.prefix+"module"))
+		} else {
+			e.requireNamespace = true
+			required = append(required, jsonString(url)+": "+e.prefix)
+			refs = append(refs, jToken(e.prefix))
+		}
+	}
+
+	if len(required) > 0 {
+		params += ", require"
+		args += ", url => ({" + strings.Join(required, ", ") + "})[url]"
+	}
+
+	tks := parser.NewStringTokeniser("const " + d.prefix + "module = {exports: {}};\n(function (" + params + ") {\n" + bodyMarker + ";\n}).call(" + d.prefix + "module.exports, " + args + ");")
+
+	m, err := javascript.ParseModule(&tks)
+	if err != nil {
+		return d.error("", "", nil, fmt.Errorf("error wrapping CommonJS module: %w", err))
+	}
+
+	if err := spliceBody(m, module.ModuleListItems); err != nil {
+		return err
+	}
+
+	d.addItem(m.ModuleListItems[0], nil, jToken(d.prefix+"module"))
+	d.addItem(m.ModuleListItems[1], module.Tokens).refs = refs
+	d.exports["default"] = &importBinding{binding: "default"}
+
+	if d.commonJSExport("default") == nil {
+		return d.error("", "default", nil, fmt.Errorf("error creating CommonJS export: %w", ErrInvalidExport))
+	}
+
+	return nil
+}
+
+func (d *dependency) findRequires(module *javascript.Module) (map[string]*dependency, error) {
+	var (
+		requires = make(map[string]*dependency)
+		globals  = make(map[*javascript.Token]struct{})
+		find     walk.HandlerFunc
+	)
+
+	if bindings := d.scope.Bindings["require"]; len(bindings) > 0 && (bindings[0].BindingType == scope.BindingRef || bindings[0].BindingType == scope.BindingBare) {
+		for _, b := range bindings {
+			globals[b.Token] = struct{}{}
+		}
+	}
+
+	find = func(t javascript.Type) error {
+		if ce, ok := t.(*javascript.CallExpression); ok {
+			if tk := requireURL(ce, globals); tk != nil {
+				durl, _ := javascript.Unquote(tk.Data)
+
+				if url, err := d.RelTo(durl); err != nil {
+					if err := d.config.addError(d.error(durl, "", tk, err)); err != nil {
+						return err
+					}
+				} else {
+					if e, err := d.addDepImport(url, tk, nil, importStatic); err == nil {
+						requires[url] = e
+					} else if err := d.config.addError(err); err != nil {
+						return err
+					}
+
+					tk.Data = strconv.Quote(url)
+				}
+			}
+		}
+
+		return walk.Walk(t, find)
+	}
+
+	if err := walk.Walk(module, find); err != nil {
+		return nil, err
+	}
+
+	return requires, nil
+}
+
+// requireURL returns the string literal specifier of a call to the global
+// require func, the references to which are given by globals.
+func requireURL(ce *javascript.CallExpression, globals map[*javascript.Token]struct{}) *javascript.Token {
+	if ce.MemberExpression == nil || ce.MemberExpression.PrimaryExpression == nil || ce.MemberExpression.PrimaryExpression.IdentifierReference == nil || ce.Arguments == nil || len(ce.Arguments.ArgumentList) != 1 || ce.Arguments.ArgumentList[0].Spread {
+		return nil
+	} else if _, ok := globals[ce.MemberExpression.PrimaryExpression.IdentifierReference]; !ok {
+		return nil
+	}
+
+	pe, ok := javascript.UnwrapConditional(ce.Arguments.ArgumentList[0].AssignmentExpression.ConditionalExpression).(*javascript.PrimaryExpression)
+	if !ok || pe.Literal == nil || pe.Literal.Type != javascript.TokenStringLiteral {
+		return nil
+	}
+
+	return pe.Literal
+}
+
+func (d *dependency) commonJSExport(binding string) *scope.Binding {
+	if b, ok := d.cjsExports[binding]; ok {
+		return b
+	} else if binding != "default" && !isIdentifier(binding) {
+		return nil
+	}
+
+	value := d.prefix + "module.exports"
+
+	if binding != "default" {
+		value += "." + binding
+	}
+
+	name := d.commonJSName(binding)
+	tks := parser.NewStringTokeniser("const " + name + " = " + value + ";")
+
+	m, err := javascript.ParseModule(&tks)
+	if err != nil {
+		return nil
+	}
+
+	tk := jToken(name)
+	b := &scope.Binding{BindingType: scope.BindingLexicalConst, Token: tk}
+
+	d.addItem(m.ModuleListItems[0], nil, tk).refs = []*javascript.Token{jToken(d.prefix + "module")}
+	d.cjsExports[binding] = b
+	d.exports[binding] = &importBinding{binding: binding}
+
+	return b
+}
+
+// namespaceCommonJS creates the namespace object of a CommonJS module, which
+// forwards every property of its module.exports value, along with the value
+// itself as the default export.
+//
+// As the namespace is created before the module is evaluated, the properties
+// are read from module.exports when accessed.
+func (d *dependency) namespaceCommonJS() (javascript.LexicalBinding, []string, error) {
+	tks := parser.NewStringTokeniser(fmt.Sprintf(commonJSNamespace, d.prefix, d.prefix+"module.exports"))
+
+	m, err := javascript.ParseModule(&tks)
+	if err != nil {
+		return javascript.LexicalBinding{}, nil, d.error("", "*", nil, fmt.Errorf("error creating CommonJS namespace: %w", err))
+	}
+
+	return m.ModuleListItems[0].StatementListItem.Declaration.LexicalDeclaration.BindingList[0], []string{d.prefix + "module"}, nil
+}
+
+// commonJSName returns the name of the binding that will hold the given export.
+//
+// Exports named module, followed by any number of underscores, gain an extra
+// underscore, so as not to collide with the wrapping module object.
+func (d *dependency) commonJSName(binding string) string {
+	if strings.TrimRight(binding, "_") == "module" {
+		binding += "_"
+	}
+
+	return d.prefix + binding
+}
@@ -0,0 +1,121 @@
+package jspacker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/javascript/scope"
+)
+
+func (c *config) addCycle(cycle []*dependency) {
+	c.cycles = append(c.cycles, cycle)
+
+	if c.cycleFn != nil {
+		c.cycleFn(cycleURLs(cycle))
+	}
+}
+
+func cycleURLs(cycle []*dependency) []string {
+	urls := make([]string, len(cycle))
+
+	for n, d := range cycle {
+		urls[n] = d.url
+	}
+
+	return urls
+}
+
+func (d *dependency) findTopLevelImports() {
+	for name, bindings := range sortedMap(d.scope.Bindings) {
+		if len(bindings) == 0 || bindings[0].BindingType != scope.BindingImport {
+			continue
+		}
+
+		for _, ref := range bindings[1:] {
+			if isTopLevel(d.scope, ref.Scope) && d.itemContaining(ref.Token) != nil {
+				d.topLevelImports = append(d.topLevelImports, name)
+
+				break
+			}
+		}
+	}
+}
+
+func isTopLevel(module, s *scope.Scope) bool {
+	for ; s != nil && s != module; s = s.Parent {
+		if !s.IsLexicalScope {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *config) checkCycles(order map[*dependency]int) error {
+	for _, d := range sortedMap(c.filesDone) {
+		for _, name := range d.topLevelImports {
+			ib, ok := d.imports[name]
+			if !ok {
+				continue
+			}
+
+			source, _ := ib.dependency.exportSource(ib.binding)
+			if source == nil || order[source] <= order[d] {
+				continue
+			}
+
+			return d.error(ib.url, ib.binding, d.bindingToken(name), fmt.Errorf("%w: %s is used before it is evaluated (%s)", ErrCircularDependency, name, strings.Join(c.cycleContaining(d, source), " -> ")))
+		}
+	}
+
+	return nil
+}
+
+// exportSource follows the given export through any re-exports and imports to
+// the module that declares it, returning that module and the name of the
+// binding there.
+//
+// An export that is re-exported in a cycle has no source, and returns a nil
+// dependency.
+func (d *dependency) exportSource(binding string) (*dependency, string) {
+	seen := make(map[importBinding]struct{})
+
+	for !d.cjs {
+		key := importBinding{dependency: d, binding: binding}
+
+		if _, ok := seen[key]; ok {
+			return nil, ""
+		}
+
+		seen[key] = struct{}{}
+
+		export, ok := d.exports[binding]
+		if !ok {
+			break
+		} else if export.dependency != nil {
+			d, binding = export.dependency, export.binding
+
+			continue
+		}
+
+		imp, ok := d.imports[export.binding]
+		if !ok {
+			return d, export.binding
+		}
+
+		d, binding = imp.dependency, imp.binding
+	}
+
+	return d, binding
+}
+
+func (c *config) cycleContaining(a, b *dependency) []string {
+	for _, cycle := range c.cycles {
+		if slices.Contains(cycle, a) && slices.Contains(cycle, b) {
+			return cycleURLs(cycle)
+		}
+	}
+
+	return []string{a.url, b.url, a.url}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"slices"
 	"strconv"
 
 	"vimagination.zapto.org/javascript"
@@ -15,21 +16,47 @@ import (
 type importBinding struct {
 	*dependency
 	binding string
+	star    bool
+}
+
+type moduleItem struct {
+	javascript.ModuleItem
+	dependency     *dependency
+	tokens         javascript.Tokens
+	declares, refs []*javascript.Token
+	keep           bool
 }
 
 type dependency struct {
 	config             *config
+	importer           *dependency
 	url                string
 	scope              *scope.Scope
 	requires           map[string]*dependency
+	requireOrder       []*dependency
+	importKinds        map[string]importKind
+	topLevelImports    []string
+	dynamicRequires    map[string]*dependency
 	imports, exports   map[string]*importBinding
 	prefix             string
+	typ                string
+	items              []*moduleItem
+	sourceItems        []*moduleItem
+	tokens             javascript.Tokens
 	dynamicRequirement bool
+	dynamicImport      bool
 	needsMeta          bool
 	done               bool
+	entry              bool
+	chunk              *chunk
 	primary            bool
 	requireNamespace   bool
 	requireMeta        bool
+	cjs                bool
+	failed             bool
+	failedExports      map[string]struct{}
+	failedExportAll    bool
+	cjsExports         map[string]*scope.Binding
 }
 
 func id2String(id uint) string {
@@ -50,59 +77,126 @@ func id2String(id uint) string {
 	return string(p[n:])
 }
 
-func (d *dependency) addDepImport(url string) (*dependency, error) {
-	return d.addImport(url, false)
+type importKind uint8
+
+const (
+	importStatic importKind = 1 << iota
+	importReExport
+)
+
+func (d *dependency) addDepImport(url string, tk *javascript.Token, wc *javascript.WithClause, kind importKind) (*dependency, error) {
+	e, err := d.addImport(url, importType(wc), false)
+	if err != nil {
+		return nil, d.error(url, "", tk, err)
+	}
+
+	if d.importKinds == nil {
+		d.importKinds = make(map[string]importKind)
+	}
+
+	d.importKinds[url] |= kind
+
+	return e, nil
 }
 
-func (d *dependency) addImport(url string, primary bool) (*dependency, error) {
-	c := d.config
+func (d *dependency) addImport(url, typ string, primary bool) (*dependency, error) {
+	e, err := d.config.load(d, url, typ, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := d.requires[url]; !ok {
+		d.requires[url] = e
+		d.requireOrder = append(d.requireOrder, e)
+	}
 
+	return e, nil
+}
+
+func (d *dependency) addDynamicImport(url string) (*dependency, error) {
+	e, err := d.config.load(d, url, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.dynamicRequires == nil {
+		d.dynamicRequires = make(map[string]*dependency)
+	}
+
+	d.dynamicRequires[url] = e
+	e.dynamicImport = true
+
+	return e, nil
+}
+
+func (c *config) load(importer *dependency, url, typ string, primary bool) (*dependency, error) {
 	e, ok := c.filesDone[url]
 	if !ok {
 		c.nextID++
 		id := c.nextID
 		e = &dependency{
 			config:   c,
+			importer: importer,
 			url:      url,
 			requires: make(map[string]*dependency),
 			imports:  make(map[string]*importBinding),
 			exports:  make(map[string]*importBinding),
 			prefix:   id2String(id),
+			typ:      typ,
 			primary:  primary,
 		}
 		c.filesDone[url] = e
 
 		if err := e.process(); err != nil {
+			e.failed = true
+
 			return nil, err
 		}
 	}
 
-	d.requires[url] = e
-
 	return e, nil
 }
 
 func (d *dependency) process() error {
-	module, err := d.config.loader(d.url)
+	module, err := d.config.loadModule(d.url, d.typ)
 	if err != nil {
 		return err
 	}
 
+	if d.config.sourceMap != nil {
+		d.tokens = module.Tokens
+	}
+
 	d.scope, err = scope.ModuleScope(module, nil)
 	if err != nil {
 		var dupeErr scope.ErrDuplicateDeclaration
 
 		if errors.As(err, &dupeErr) {
-			return fmt.Errorf("error processing scope in file %s: %w: %v", d.url, err, dupeErr)
+			return d.error("", "", dupeErr.Duplicate, fmt.Errorf("error processing scope: %w: %v", err, dupeErr))
 		}
 
-		return fmt.Errorf("error processing scope in file %s: %w", d.url, err)
+		return d.error("", "", nil, fmt.Errorf("error processing scope: %w", err))
 	}
 
-	if err := d.processModuleListItems(module); err != nil {
+	if isCommonJS(module, d.scope) {
+		if err := d.processCommonJS(module); err != nil {
+			return err
+		}
+	} else if err := d.processModuleListItems(module); err != nil {
 		return err
 	}
 
+	if d.config.warnFn != nil {
+		d.warnUnusedImports()
+		d.warnDirectEval(module)
+	}
+
+	d.mapItemBindings()
+
+	if d.config.strictCycles {
+		d.findTopLevelImports()
+	}
+
 	if d.needsMeta {
 		d.addMeta()
 	}
@@ -125,7 +219,7 @@ func (d *dependency) processModuleListItems(module *javascript.Module) error {
 				return err
 			}
 		} else if li.StatementListItem != nil {
-			d.config.moduleItems = append(d.config.moduleItems, li)
+			d.addItem(li, li.Tokens)
 		} else if li.ExportDeclaration != nil {
 			if err := d.handleExports(li); err != nil {
 				return err
@@ -136,16 +230,36 @@ func (d *dependency) processModuleListItems(module *javascript.Module) error {
 	return nil
 }
 
+func (d *dependency) addItem(mi javascript.ModuleItem, tks javascript.Tokens, declares ...*javascript.Token) *moduleItem {
+	item := &moduleItem{
+		ModuleItem: mi,
+		dependency: d,
+		tokens:     tks,
+		declares:   declares,
+		keep:       true,
+	}
+
+	d.items = append(d.items, item)
+	d.config.items = append(d.config.items, item)
+
+	if len(tks) > 0 {
+		d.sourceItems = append(d.sourceItems, item)
+	}
+
+	return item
+}
+
 func (d *dependency) handleImports(id *javascript.ImportDeclaration) error {
 	durl, _ := javascript.Unquote(id.FromClause.ModuleSpecifier.Data)
-	iurl := d.RelTo(durl)
-
-	e, err := d.addDepImport(iurl)
+	iurl, err := d.RelTo(durl)
 	if err != nil {
-		return err
+		return d.config.addError(d.error(durl, "", id.FromClause.ModuleSpecifier, err))
 	}
 
-	if id.ImportClause == nil {
+	e, err := d.addDepImport(iurl, id.FromClause.ModuleSpecifier, id.WithClause, importStatic)
+	if err != nil {
+		return d.config.addError(err)
+	} else if id.ImportClause == nil {
 		return nil
 	}
 
@@ -162,11 +276,27 @@ func (d *dependency) handleImports(id *javascript.ImportDeclaration) error {
 	return nil
 }
 
+func importType(wc *javascript.WithClause) string {
+	if wc == nil {
+		return ""
+	}
+
+	for _, we := range wc.WithEntries {
+		if key, err := javascript.Unquote(we.AttributeKey.Data); key == "type" || err != nil && we.AttributeKey.Data == "type" {
+			typ, _ := javascript.Unquote(we.Value.Data)
+
+			return typ
+		}
+	}
+
+	return ""
+}
+
 func (d *dependency) handleNamespaceImport(e *dependency, ns *javascript.Token) {
 	d.setImportBinding(ns.Data, e, "*")
 
 	e.requireNamespace = true
-	d.config.moduleItems = append(d.config.moduleItems, namespaceImport(ns, e.prefix))
+	d.addItem(namespaceImport(ns, e.prefix), nil, ns).refs = []*javascript.Token{jToken(e.prefix)}
 }
 
 func (d *dependency) handleNamedImports(e *dependency, ni *javascript.NamedImports) {
@@ -177,7 +307,7 @@ func (d *dependency) handleNamedImports(e *dependency, ni *javascript.NamedImpor
 
 func (d *dependency) handleExports(li javascript.ModuleItem) error {
 	if d.primary {
-		d.config.moduleItems = append(d.config.moduleItems, li)
+		d.addItem(li, li.Tokens)
 	} else if ed := li.ExportDeclaration; ed.FromClause != nil {
 		if err := d.handleExportDeclarationWithFrom(ed); err != nil {
 			return err
@@ -198,8 +328,17 @@ func (d *dependency) handleExports(li javascript.ModuleItem) error {
 func (d *dependency) handleExportDeclarationWithFrom(ed *javascript.ExportDeclaration) error {
 	durl, _ := javascript.Unquote(ed.FromClause.ModuleSpecifier.Data)
 
-	if e, err := d.addDepImport(d.RelTo(durl)); err != nil {
-		return err
+	iurl, err := d.RelTo(durl)
+	if err != nil {
+		d.setFailedExports(ed)
+
+		return d.config.addError(d.error(durl, "", ed.FromClause.ModuleSpecifier, err))
+	}
+
+	if e, err := d.addDepImport(iurl, ed.FromClause.ModuleSpecifier, ed.WithClause, importReExport); err != nil {
+		d.setFailedExports(ed)
+
+		return d.config.addError(err)
 	} else if ed.ExportClause != nil {
 		for _, es := range ed.ExportClause.ExportList {
 			d.setExportBinding(cmp.Or(es.EIdentifierName, es.IdentifierName).Data, e, es.IdentifierName.Data)
@@ -213,6 +352,24 @@ func (d *dependency) handleExportDeclarationWithFrom(ed *javascript.ExportDeclar
 	return nil
 }
 
+func (d *dependency) setFailedExports(ed *javascript.ExportDeclaration) {
+	if ed.ExportClause == nil && ed.ExportFromClause == nil {
+		d.failedExportAll = true
+
+		return
+	} else if d.failedExports == nil {
+		d.failedExports = make(map[string]struct{})
+	}
+
+	if ed.ExportClause != nil {
+		for _, es := range ed.ExportClause.ExportList {
+			d.failedExports[cmp.Or(es.EIdentifierName, es.IdentifierName).Data] = struct{}{}
+		}
+	} else {
+		d.failedExports[ed.ExportFromClause.Data] = struct{}{}
+	}
+}
+
 func (d *dependency) handleExportClause(ec *javascript.ExportClause) {
 	for _, es := range ec.ExportList {
 		d.setExportBinding(cmp.Or(es.EIdentifierName, es.IdentifierName).Data, nil, es.IdentifierName.Data)
@@ -224,7 +381,7 @@ func (d *dependency) handleExportVariable(v *javascript.VariableStatement) {
 		d.processBindingElement(vd.BindingIdentifier, vd.ArrayBindingPattern, vd.ObjectBindingPattern)
 	}
 
-	d.config.moduleItems = append(d.config.moduleItems, wrapVariableStatement(v))
+	d.addItem(wrapVariableStatement(v), v.Tokens)
 }
 
 func (d *dependency) handleExportDeclaration(ed *javascript.Declaration) {
@@ -238,7 +395,7 @@ func (d *dependency) handleExportDeclaration(ed *javascript.Declaration) {
 		}
 	}
 
-	d.config.moduleItems = append(d.config.moduleItems, wrapDeclaration(ed))
+	d.addItem(wrapDeclaration(ed), ed.Tokens)
 }
 
 func (d *dependency) handleExportDefault(ed *javascript.ExportDeclaration) {
@@ -274,7 +431,7 @@ func (d *dependency) handleExportDefaultFunction(def *javascript.Token, f *javas
 		delete(d.scope.Bindings, def.Data)
 	}
 
-	d.config.moduleItems = append(d.config.moduleItems, wrapFunctionDeclaration(f))
+	d.addItem(wrapFunctionDeclaration(f), f.Tokens, f.BindingIdentifier)
 }
 
 func (d *dependency) handleExportDefaultClass(def *javascript.Token, c *javascript.ClassDeclaration) {
@@ -287,11 +444,11 @@ func (d *dependency) handleExportDefaultClass(def *javascript.Token, c *javascri
 		delete(d.scope.Bindings, def.Data)
 	}
 
-	d.config.moduleItems = append(d.config.moduleItems, wrapClassDeclaration(c))
+	d.addItem(wrapClassDeclaration(c), c.Tokens, c.BindingIdentifier)
 }
 
 func (d *dependency) handleExportDefaultAssignment(def *javascript.Token, a *javascript.AssignmentExpression) {
-	d.config.moduleItems = append(d.config.moduleItems, wrapDefaultAssignment(def, a))
+	d.addItem(wrapDefaultAssignment(def, a), a.Tokens, def)
 }
 
 func (d *dependency) addMeta() {
@@ -301,10 +458,15 @@ func (d *dependency) addMeta() {
 
 func (d *dependency) Handle(t javascript.Type) error {
 	if ce, ok := t.(*javascript.CallExpression); ok && isConditionalExpression(ce.ImportCall) {
-		d.HandleImportConditional(ce.ImportCall.ConditionalExpression)
+		if err := d.HandleImportConditional(ce.ImportCall.ConditionalExpression); err != nil {
+			return err
+		}
+
 		replaceImportCall(ce)
 	} else if ok && ce.MemberExpression != nil && ce.MemberExpression.PrimaryExpression != nil && ce.MemberExpression.PrimaryExpression.IdentifierReference != nil && ce.MemberExpression.PrimaryExpression.IdentifierReference.Data == "include" && ce.MemberExpression.MemberExpression == nil && ce.MemberExpression.Expression == nil && ce.MemberExpression.IdentifierName == nil && ce.MemberExpression.TemplateLiteral == nil && !ce.MemberExpression.SuperProperty && !ce.MemberExpression.NewTarget && !ce.MemberExpression.ImportMeta && ce.MemberExpression.Arguments == nil && !ce.SuperCall && ce.ImportCall == nil && ce.Arguments != nil && ce.Expression == nil && ce.IdentifierName == nil && ce.TemplateLiteral == nil && len(ce.Arguments.ArgumentList) == 1 {
-		d.HandleImportConditional(ce.Arguments.ArgumentList[0].AssignmentExpression.ConditionalExpression)
+		if err := d.HandleImportConditional(ce.Arguments.ArgumentList[0].AssignmentExpression.ConditionalExpression); err != nil {
+			return err
+		}
 	} else if d.config != nil {
 		if me, ok := t.(*javascript.MemberExpression); ok && me.ImportMeta {
 			d.needsMeta = true
@@ -318,32 +480,51 @@ func (d *dependency) Handle(t javascript.Type) error {
 	return walk.Walk(t, d)
 }
 
-func (d *dependency) HandleImportConditional(ce *javascript.ConditionalExpression) {
+func (d *dependency) HandleImportConditional(ce *javascript.ConditionalExpression) error {
 	if ce.True != nil && ce.False != nil {
 		if isConditionalExpression(ce.True) {
-			d.HandleImportConditional(ce.True.ConditionalExpression)
+			if err := d.HandleImportConditional(ce.True.ConditionalExpression); err != nil {
+				return err
+			}
 		}
 
 		if isConditionalExpression(ce.False) {
-			d.HandleImportConditional(ce.False.ConditionalExpression)
+			return d.HandleImportConditional(ce.False.ConditionalExpression)
 		}
 	} else if pe, ok := javascript.UnwrapConditional(ce).(*javascript.PrimaryExpression); ok && pe.Literal != nil && pe.Literal.Type == javascript.TokenStringLiteral {
 		durl, _ := javascript.Unquote(pe.Literal.Data)
-		iurl := d.RelTo(durl)
+
+		iurl, err := d.RelTo(durl)
+		if err != nil {
+			return d.config.addError(d.error(durl, "", pe.Literal, err))
+		}
+
 		pe.Literal.Data = strconv.Quote(iurl)
 
 		if d.config != nil {
-			d.addDepImport(iurl)
+			if _, err := d.addDynamicImport(iurl); err != nil {
+				return d.config.addError(d.error(iurl, "", pe.Literal, err))
+			}
 
 			d.dynamicRequirement = true
+			d.config.dynamicRequirement = true
+			d.config.dynamicURLs = append(d.config.dynamicURLs, pe.Literal)
 		}
+	} else if len(ce.Tokens) > 0 {
+		d.warn(WarnDynamicImport, &ce.Tokens[0], "dynamic import with a non-literal specifier cannot be resolved")
 	}
+
+	return nil
 }
 
-func (d *dependency) RelTo(url string) string {
+func (d *dependency) RelTo(url string) (string, error) {
 	return d.config.resolveURL(d.url, url)
 }
 
+func relTo(from, to string) (string, error) {
+	return RelTo(from, to), nil
+}
+
 func RelTo(from, to string) string {
 	if len(to) > 0 && to[0] == '/' {
 		return to
@@ -405,6 +586,8 @@ func (d *dependency) resolveExport(binding string) *scope.Binding {
 		return &scope.Binding{
 			Token: jToken(d.prefix),
 		}
+	} else if d.cjs {
+		return d.commonJSExport(binding)
 	} else if export, ok := d.exports[binding]; !ok {
 		return nil
 	} else if export.dependency != nil {
@@ -418,8 +601,27 @@ func (d *dependency) resolveExport(binding string) *scope.Binding {
 	}
 }
 
+// exportFailed determines whether the given export cannot be resolved because
+// the module it is re-exported from failed to load, in which case the error
+// has already been recorded.
+func (d *dependency) exportFailed(binding string) bool {
+	if d.failed {
+		return true
+	} else if _, ok := d.failedExports[binding]; ok {
+		return true
+	} else if export, ok := d.exports[binding]; !ok {
+		return d.failedExportAll && binding != "default"
+	} else if export.dependency != nil {
+		return export.dependency.exportFailed(export.binding)
+	} else if imp, ok := d.imports[export.binding]; ok {
+		return imp.dependency.exportFailed(imp.binding)
+	}
+
+	return false
+}
+
 func (d *dependency) resolveImports() error {
-	if d.done {
+	if d.done || d.failed {
 		return nil
 	}
 
@@ -431,14 +633,26 @@ func (d *dependency) resolveImports() error {
 		}
 	}
 
+	for _, r := range d.dynamicRequires {
+		if err := r.resolveImports(); err != nil {
+			return err
+		}
+	}
+
 	for name, binding := range d.imports {
-		if binding.binding == "*" {
+		if binding.binding == "*" || binding.dependency.failed {
 			continue
 		}
 
 		b := binding.dependency.resolveExport(binding.binding)
 		if b == nil {
-			return fmt.Errorf("error resolving import %s (%s): %w", name, d.url, ErrInvalidExport)
+			if binding.dependency.exportFailed(binding.binding) {
+				continue
+			} else if err := d.config.addError(d.error(binding.url, binding.binding, d.bindingToken(name), ErrInvalidExport)); err != nil {
+				return err
+			}
+
+			continue
 		}
 
 		for _, c := range d.scope.Bindings[name] {
@@ -449,6 +663,61 @@ func (d *dependency) resolveImports() error {
 	return nil
 }
 
+func (c *config) orderItems() error {
+	var (
+		items   = make([]*moduleItem, 0, len(c.items))
+		order   = make(map[*dependency]int)
+		visited = make(map[*dependency]bool)
+		stack   []*dependency
+		visit   func(*dependency)
+	)
+
+	visit = func(d *dependency) {
+		if visited[d] {
+			if n := slices.Index(stack, d); n >= 0 {
+				c.addCycle(append(slices.Clone(stack[n:]), d))
+			}
+
+			return
+		}
+
+		visited[d] = true
+		stack = append(stack, d)
+
+		for _, r := range d.requireOrder {
+			visit(r)
+		}
+
+		stack = stack[:len(stack)-1]
+		order[d] = len(order)
+		items = append(items, d.items...)
+	}
+
+	for _, entry := range c.requireOrder {
+		visit(entry)
+	}
+
+	for _, item := range c.items {
+		visit(item.dependency)
+	}
+
+	c.items = items
+
+	if c.strictCycles {
+		return c.checkCycles(order)
+	}
+
+	return nil
+}
+
+func (d *dependency) bindingToken(name string) *javascript.Token {
+	if bindings := d.scope.Bindings[name]; len(bindings) > 0 {
+		return bindings[0].Token
+	}
+
+	return nil
+}
+
 func (d *dependency) processBindings(s *scope.Scope) {
 	for name, bindings := range s.Bindings {
 		if len(bindings) == 0 || bindings[0].BindingType == scope.BindingRef || bindings[0].BindingType == scope.BindingBare || bindings[0].BindingType == scope.BindingImport {
@@ -1,10 +1,149 @@
 package jspacker
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/javascript"
+)
 
 // Errors.
 var (
-	ErrInvalidExport = errors.New("invalid export")
-	ErrInvalidURL    = errors.New("added files must be absolute URLs")
-	ErrNoFiles       = errors.New("no files")
+	ErrBlockedImport      = errors.New("import blocked by import map")
+	ErrCircularDependency = errors.New("unsafe circular dependency")
+	ErrGlobalNoExports    = errors.New("global name requires primary exports")
+	ErrInvalidExport      = errors.New("invalid export")
+	ErrInvalidGlobalName  = errors.New("invalid global name")
+	ErrInvalidJSON        = errors.New("invalid JSON")
+	ErrInvalidPackage     = errors.New("invalid package.json")
+	ErrInvalidWrappedItem = errors.New("import and export declarations cannot be wrapped")
+	ErrInvalidURL         = errors.New("added files must be absolute URLs")
+	ErrMinifySourceMap    = errors.New("cannot minify output when generating a source map")
+	ErrNoFiles            = errors.New("no files")
+	ErrNotExported        = errors.New("package subpath is not exported")
+	ErrSplitFormat        = errors.New("code splitting requires ESM output")
+	ErrTooManyErrors      = errors.New("too many errors")
+	ErrTopLevelAwait      = errors.New("top-level await cannot be used with the output format")
+	ErrUnsupportedType    = errors.New("unsupported import type")
 )
+
+// Error is returned by Package, Graph, and Plugin for errors that can be
+// attributed to a position in a module, and can be retrieved with errors.As.
+//
+// The underlying error, such as ErrInvalidExport, can be checked with
+// errors.Is.
+type Error struct {
+	// Importer is the URL of the module in which the error occurred.
+	Importer string
+
+	// Imported is the URL of the imported module, if any, that caused the
+	// error.
+	Imported string
+
+	// Binding is the name of the imported, or exported, binding, if any,
+	// that caused the error.
+	Binding string
+
+	// Line and Column are the 1-indexed position of the error in the
+	// Importer module; these are zero when the position is unknown.
+	Line, Column uint64
+
+	// Chain lists the URLs of the modules imported to reach the Importer,
+	// starting with an entry file and ending with the Importer.
+	Chain []string
+
+	Err error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Importer)
+
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d:%d", e.Line, e.Column)
+	}
+
+	sb.WriteString(": ")
+
+	if e.Imported != "" && e.Binding != "" {
+		fmt.Fprintf(&sb, "error importing %s from %s: ", e.Binding, e.Imported)
+	} else if e.Imported != "" {
+		fmt.Fprintf(&sb, "error importing %s: ", e.Imported)
+	} else if e.Binding != "" {
+		fmt.Fprintf(&sb, "error resolving %s: ", e.Binding)
+	}
+
+	sb.WriteString(e.Err.Error())
+
+	if len(e.Chain) > 1 {
+		fmt.Fprintf(&sb, " (imported via %s)", strings.Join(e.Chain, " -> "))
+	}
+
+	return sb.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (d *dependency) error(imported, binding string, tk *javascript.Token, err error) error {
+	var e *Error
+
+	if errors.As(err, &e) {
+		return err
+	}
+
+	e = &Error{
+		Importer: d.url,
+		Imported: imported,
+		Binding:  binding,
+		Chain:    d.importChain(),
+		Err:      err,
+	}
+
+	if tk != nil {
+		e.Line = tk.Line + 1
+		e.Column = tk.LinePos + 1
+	}
+
+	return e
+}
+
+func (d *dependency) importChain() []string {
+	var chain []string
+
+	for ; d != nil && d.url != ""; d = d.importer {
+		chain = append(chain, d.url)
+	}
+
+	slices.Reverse(chain)
+
+	return chain
+}
+
+func (c *config) addError(err error) error {
+	if errors.Is(err, ErrTooManyErrors) {
+		return err
+	}
+
+	c.errors = append(c.errors, err)
+
+	if c.maxErrors > 0 && len(c.errors) >= c.maxErrors {
+		return ErrTooManyErrors
+	}
+
+	return nil
+}
+
+func (c *config) joinErrors() error {
+	if c.maxErrors > 0 && len(c.errors) >= c.maxErrors {
+		return errors.Join(append(c.errors, ErrTooManyErrors)...)
+	}
+
+	return errors.Join(c.errors...)
+}
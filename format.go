@@ -0,0 +1,181 @@
+package jspacker
+
+import (
+	"fmt"
+	"slices"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/javascript/walk"
+	"vimagination.zapto.org/parser"
+)
+
+// OutputFormat determines how the output of Package is wrapped.
+type OutputFormat uint8
+
+// Output formats.
+const (
+	FormatESM OutputFormat = iota
+	FormatIIFE
+	FormatCJS
+	FormatUMD
+)
+
+const bodyMarker = "jspacker_body"
+
+func (c *config) wrapFormat() error {
+	var exports string
+
+	if c.exportsFile != nil {
+		exports = c.exportsFile.prefix
+	}
+
+	var src string
+
+	switch c.format {
+	case FormatIIFE:
+		src = "(() => {\n\"use strict\";\n" + bodyMarker + ";\n" + formatReturn(exports) + "})();"
+
+		if c.globalName != "" && exports != "" {
+			src = "var " + c.globalName + " = " + src
+		}
+	case FormatCJS:
+		src = "\"use strict\";\n" + bodyMarker + ";\n"
+
+		if exports != "" {
+			src += "module.exports = " + exports + ";"
+		}
+	case FormatUMD:
+		global := "factory();"
+
+		if c.globalName != "" {
+			global = "globalThis." + c.globalName + " = " + global
+		}
+
+		src = "(factory => {\nif (typeof define === \"function\" && define.amd) {\ndefine([], factory);\n} else if (typeof module === \"object\" && module.exports) {\nmodule.exports = factory();\n} else {\n" + global + "\n}\n})(() => {\n\"use strict\";\n" + bodyMarker + ";\n" + formatReturn(exports) + "});"
+	default:
+		return nil
+	}
+
+	if hasTopLevelAwait(c.moduleItems) {
+		return ErrTopLevelAwait
+	}
+
+	tks := parser.NewStringTokeniser(src)
+
+	m, err := javascript.ParseModule(&tks)
+	if err != nil {
+		return fmt.Errorf("error creating output wrapper: %w", err)
+	}
+
+	if c.format == FormatCJS {
+		c.moduleItems = slices.Concat(m.ModuleListItems[:1], c.moduleItems, m.ModuleListItems[2:])
+
+		return nil
+	}
+
+	if err := spliceBody(m, c.moduleItems); err != nil {
+		return err
+	}
+
+	c.moduleItems = m.ModuleListItems
+
+	return nil
+}
+
+func spliceBody(m *javascript.Module, items []javascript.ModuleItem) error {
+	body := make([]javascript.StatementListItem, len(items))
+
+	for n, mi := range items {
+		if mi.StatementListItem == nil {
+			return ErrInvalidWrappedItem
+		}
+
+		body[n] = *mi.StatementListItem
+	}
+
+	var replace walk.HandlerFunc
+
+	replace = func(t javascript.Type) error {
+		if b, ok := t.(*javascript.Block); ok {
+			if n := slices.IndexFunc(b.StatementList, isBodyMarker); n >= 0 {
+				b.StatementList = slices.Concat(b.StatementList[:n], body, b.StatementList[n+1:])
+
+				return nil
+			}
+		}
+
+		return walk.Walk(t, replace)
+	}
+
+	return walk.Walk(m, replace)
+}
+
+// hasTopLevelAwait determines whether any of the items use await outside of a
+// function, which would be invalid once wrapped in a non-async function.
+func hasTopLevelAwait(items []javascript.ModuleItem) bool {
+	var (
+		found bool
+		find  walk.HandlerFunc
+	)
+
+	find = func(t javascript.Type) error {
+		switch t := t.(type) {
+		case *javascript.FunctionDeclaration, *javascript.ArrowFunction:
+			return nil
+		case *javascript.MethodDefinition:
+			return find(&t.ClassElementName)
+		case *javascript.FieldDefinition:
+			return find(&t.ClassElementName)
+		case *javascript.ClassElement:
+			if t.ClassStaticBlock != nil {
+				return nil
+			}
+		case *javascript.UnaryExpression:
+			for _, op := range t.UnaryOperators {
+				if op.UnaryOperator == javascript.UnaryAwait {
+					found = true
+				}
+			}
+		case *javascript.IterationStatementFor:
+			for _, tk := range t.Tokens {
+				if tk.Data == "await" {
+					found = true
+				} else if tk.Data == "(" {
+					break
+				}
+			}
+		}
+
+		if found {
+			return nil
+		}
+
+		return walk.Walk(t, find)
+	}
+
+	for n := range items {
+		if find(&items[n]); found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatReturn(exports string) string {
+	if exports == "" {
+		return ""
+	}
+
+	return "return " + exports + ";\n"
+}
+
+func isBodyMarker(sli javascript.StatementListItem) bool {
+	if sli.Statement == nil || sli.Statement.ExpressionStatement == nil || len(sli.Statement.ExpressionStatement.Expressions) != 1 {
+		return false
+	}
+
+	pe, ok := javascript.UnwrapConditional(sli.Statement.ExpressionStatement.Expressions[0].ConditionalExpression).(*javascript.PrimaryExpression)
+
+	return ok && pe.IdentifierReference != nil && pe.IdentifierReference.Data == bodyMarker
+}
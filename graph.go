@@ -0,0 +1,186 @@
+package jspacker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ImportGraph describes the modules reachable from the files passed to Graph,
+// and the imports between them. It can be encoded as JSON, producing a
+// document of the following form:
+//
+//	{
+//		"modules": [
+//			{"url": "/main.js", "entry": true},
+//			{"url": "/lib.js"}
+//		],
+//		"edges": [
+//			{"from": "/main.js", "to": "/lib.js", "kind": "static"}
+//		]
+//	}
+type ImportGraph struct {
+	// Modules lists every loaded module, sorted by URL.
+	Modules []GraphModule `json:"modules"`
+
+	// Edges lists the imports between modules, sorted by importing module.
+	// The edges of each module are in import order, with dynamic imports
+	// last, sorted by URL.
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphModule describes a module in an ImportGraph.
+type GraphModule struct {
+	URL   string `json:"url"`
+	Entry bool   `json:"entry,omitempty"`
+}
+
+// GraphEdge describes an import of one module by another.
+type GraphEdge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// EdgeKind determines how a module is imported.
+type EdgeKind uint8
+
+// Edge kinds.
+const (
+	// EdgeStatic is an import declaration, or a static require call in a
+	// CommonJS module.
+	EdgeStatic EdgeKind = iota
+
+	// EdgeReExport is an export declaration with a from clause, such as
+	// `export * from`.
+	EdgeReExport
+
+	// EdgeDynamic is a dynamic import() or include() call.
+	EdgeDynamic
+)
+
+// String returns the name of the edge kind.
+func (e EdgeKind) String() string {
+	switch e {
+	case EdgeStatic:
+		return "static"
+	case EdgeReExport:
+		return "reexport"
+	case EdgeDynamic:
+		return "dynamic"
+	}
+
+	return "unknown"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (e EdgeKind) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// Graph loads the passed files, and all of their imports, in the same way as
+// Package, returning the resulting import graph instead of packaging the
+// modules. Dynamic imports are always parsed.
+//
+// As with Package, all errors found while loading modules are returned
+// together.
+func Graph(opts ...Option) (*ImportGraph, error) {
+	c, err := createConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.stopPrefetch()
+
+	c.parseDynamic = true
+
+	for _, url := range c.filesToDo {
+		if !strings.HasPrefix(url, "/") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidURL, url)
+		} else if url, err := c.dependency.RelTo(url); err != nil {
+			if err := c.addError(err); err != nil {
+				return nil, c.joinErrors()
+			}
+		} else if d, err := c.dependency.addImport(url, "", false); err != nil {
+			if err := c.addError(err); err != nil {
+				return nil, c.joinErrors()
+			}
+		} else {
+			d.entry = true
+		}
+	}
+
+	if len(c.errors) > 0 {
+		return nil, c.joinErrors()
+	}
+
+	g := &ImportGraph{
+		Modules: make([]GraphModule, 0, len(c.filesDone)),
+		Edges:   []GraphEdge{},
+	}
+
+	for url, file := range sortedMap(c.filesDone) {
+		g.Modules = append(g.Modules, GraphModule{URL: url, Entry: file.entry})
+
+		for _, r := range file.requireOrder {
+			kinds := file.importKinds[r.url]
+
+			if kinds&importStatic != 0 {
+				g.Edges = append(g.Edges, GraphEdge{From: url, To: r.url, Kind: EdgeStatic})
+			}
+
+			if kinds&importReExport != 0 {
+				g.Edges = append(g.Edges, GraphEdge{From: url, To: r.url, Kind: EdgeReExport})
+			}
+		}
+
+		for durl := range sortedMap(file.dynamicRequires) {
+			g.Edges = append(g.Edges, GraphEdge{From: url, To: durl, Kind: EdgeDynamic})
+		}
+	}
+
+	return g, nil
+}
+
+// WriteDOT writes the graph to the given Writer in the Graphviz DOT language.
+//
+// Entry modules are drawn with a double border, re-exports with dashed lines,
+// and dynamic imports with dotted lines.
+func (g *ImportGraph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("digraph imports {\n")
+
+	for _, m := range g.Modules {
+		sb.WriteString("\t" + dotID(m.URL))
+
+		if m.Entry {
+			sb.WriteString(" [peripheries=2]")
+		}
+
+		sb.WriteString(";\n")
+	}
+
+	for _, e := range g.Edges {
+		sb.WriteString("\t" + dotID(e.From) + " -> " + dotID(e.To))
+
+		switch e.Kind {
+		case EdgeReExport:
+			sb.WriteString(" [style=dashed]")
+		case EdgeDynamic:
+			sb.WriteString(" [style=dotted]")
+		}
+
+		sb.WriteString(";\n")
+	}
+
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+func dotID(id string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(id) + `"`
+}
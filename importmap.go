@@ -0,0 +1,185 @@
+package jspacker
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ImportMap represents an import map, as specified in the HTML standard:
+//
+//	https://html.spec.whatwg.org/multipage/webappapis.html#import-maps
+//
+// Relative URLs in the map are resolved against the root URL, '/'.
+type ImportMap struct {
+	Imports map[string]string            `json:"imports,omitempty"`
+	Scopes  map[string]map[string]string `json:"scopes,omitempty"`
+}
+
+// Merge adds the imports and scopes of the given ImportMap, replacing any
+// existing entries with the same keys.
+func (im *ImportMap) Merge(other *ImportMap) {
+	if len(other.Imports) > 0 && im.Imports == nil {
+		im.Imports = make(map[string]string, len(other.Imports))
+	}
+
+	maps.Copy(im.Imports, other.Imports)
+
+	if len(other.Scopes) > 0 && im.Scopes == nil {
+		im.Scopes = make(map[string]map[string]string, len(other.Scopes))
+	}
+
+	for scope, imports := range other.Scopes {
+		if im.Scopes[scope] == nil {
+			im.Scopes[scope] = make(map[string]string, len(imports))
+		}
+
+		maps.Copy(im.Scopes[scope], imports)
+	}
+}
+
+// Resolve resolves the given specifier, imported by the module at the given
+// URL, using the import map.
+//
+// Scopes that match the importing URL are checked first, from most to least
+// specific, followed by the top-level imports. Keys ending in '/' match any
+// specifier with that prefix, with the longest matching key being used.
+//
+// The bool return will be false if no entry in the import map matched. An
+// entry that matches but blocks the specifier, such as one with a null
+// address, or a prefix key whose address does not end in '/', returns an
+// empty string with a true bool.
+func (im *ImportMap) Resolve(from, specifier string) (string, bool) {
+	normalized, isURL := parseURLLike(from, specifier)
+	if !isURL {
+		normalized = specifier
+	}
+
+	for _, scope := range sortedKeys(im.Scopes, normalizeScope) {
+		if scope.normalized == from || strings.HasSuffix(scope.normalized, "/") && strings.HasPrefix(from, scope.normalized) {
+			if resolved, ok := resolveImportsMatch(normalized, im.Scopes[scope.key]); ok {
+				return resolved, true
+			}
+		}
+	}
+
+	return resolveImportsMatch(normalized, im.Imports)
+}
+
+// Resolver returns a func, for use with ResolveURLWithError, that resolves
+// specifiers with the import map, using the fallback func for any specifier
+// that is not matched.
+//
+// Specifiers blocked by the import map return ErrBlockedImport.
+func (im *ImportMap) Resolver(fallback func(from, to string) (string, error)) func(from, to string) (string, error) {
+	return func(from, to string) (string, error) {
+		if resolved, ok := im.Resolve(from, to); !ok {
+			return fallback(from, to)
+		} else if resolved == "" {
+			return "", fmt.Errorf("%w: %s", ErrBlockedImport, to)
+		} else {
+			return resolved, nil
+		}
+	}
+}
+
+func resolveImportsMatch(specifier string, imports map[string]string) (string, bool) {
+	for _, key := range sortedKeys(imports, normalizeSpecifierKey) {
+		value := imports[key.key]
+
+		if key.normalized == specifier {
+			if value == "" {
+				return "", true
+			}
+
+			return normalizeAddress(value), true
+		}
+
+		if !strings.HasSuffix(key.normalized, "/") || !strings.HasPrefix(specifier, key.normalized) {
+			continue
+		}
+
+		if !strings.HasSuffix(value, "/") {
+			return "", true
+		}
+
+		base := normalizeAddress(value)
+		resolved := resolveAgainst(base, specifier[len(key.normalized):])
+
+		if !strings.HasPrefix(resolved, base) {
+			return "", true
+		}
+
+		return resolved, true
+	}
+
+	return "", false
+}
+
+type importKey struct {
+	key, normalized string
+}
+
+func sortedKeys[V any](m map[string]V, normalize func(string) string) []importKey {
+	keys := make([]importKey, 0, len(m))
+
+	for key := range m {
+		if normalized := normalize(key); normalized != "" {
+			keys = append(keys, importKey{key: key, normalized: normalized})
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b importKey) int {
+		return strings.Compare(b.normalized, a.normalized)
+	})
+
+	return keys
+}
+
+func normalizeScope(scope string) string {
+	return resolveAgainst("/", scope)
+}
+
+func normalizeSpecifierKey(key string) string {
+	if normalized, ok := parseURLLike("/", key); ok {
+		return normalized
+	}
+
+	return key
+}
+
+func normalizeAddress(address string) string {
+	if normalized, ok := parseURLLike("/", address); ok {
+		return normalized
+	}
+
+	return RelTo("/", address)
+}
+
+func parseURLLike(base, specifier string) (string, bool) {
+	if strings.HasPrefix(specifier, "/") || strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") {
+		return resolveAgainst(base, specifier), true
+	}
+
+	if u, err := url.Parse(specifier); err == nil && u.Scheme != "" {
+		return specifier, true
+	}
+
+	return "", false
+}
+
+func resolveAgainst(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return b.ResolveReference(r).String()
+}
@@ -0,0 +1,199 @@
+package jspacker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/parser"
+)
+
+// JSONModule creates a module from the given JSON data, with the value as the
+// default export.
+//
+// When the value is an object, each top-level key that is a valid identifier
+// is also exported as a named binding, allowing unused keys to be removed by
+// the TreeShake Option.
+func JSONModule(data []byte) (*javascript.Module, error) {
+	if !json.Valid(data) {
+		return nil, ErrInvalidJSON
+	}
+
+	var src strings.Builder
+
+	if obj, ok := jsonObject(data); ok {
+		var (
+			keys   []string
+			values = make(map[string]string)
+		)
+
+		for _, entry := range obj {
+			if _, ok := values[entry.key]; !ok {
+				keys = append(keys, entry.key)
+			}
+
+			values[entry.key] = jsonValue(entry.value)
+		}
+
+		var def strings.Builder
+
+		def.WriteString("export default {")
+
+		for n, key := range keys {
+			if n > 0 {
+				def.WriteString(", ")
+			}
+
+			if isIdentifier(key) {
+				src.WriteString("export const " + key + " = " + values[key] + ";\n")
+				def.WriteString(jsonString(key) + ": " + key)
+			} else {
+				def.WriteString(jsonPropertyName(key) + ": " + values[key])
+			}
+		}
+
+		def.WriteString("};")
+		src.WriteString(def.String())
+	} else {
+		src.WriteString("export default " + jsonValue(data) + ";")
+	}
+
+	tks := parser.NewStringTokeniser(src.String())
+
+	return javascript.ParseModule(&tks)
+}
+
+type jsonEntry struct {
+	key   string
+	value json.RawMessage
+}
+
+// jsonObject returns the entries of the given JSON object in the order they
+// appear, including any duplicate keys. It returns false if the data is not an
+// object.
+func jsonObject(data json.RawMessage) ([]jsonEntry, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tk, err := dec.Token(); err != nil || tk != json.Delim('{') {
+		return nil, false
+	}
+
+	var entries []jsonEntry
+
+	for dec.More() {
+		tk, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+
+		key, ok := tk.(string)
+		if !ok {
+			return nil, false
+		}
+
+		var value json.RawMessage
+
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+
+		entries = append(entries, jsonEntry{key: key, value: value})
+	}
+
+	return entries, true
+}
+
+func jsonValue(data json.RawMessage) string {
+	var sb strings.Builder
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+
+	writeJSONValue(&sb, dec)
+
+	return sb.String()
+}
+
+func writeJSONValue(sb *strings.Builder, dec *json.Decoder) {
+	tk, _ := dec.Token()
+
+	switch tk := tk.(type) {
+	case json.Delim:
+		if tk == '{' {
+			sb.WriteByte('{')
+
+			for n := 0; dec.More(); n++ {
+				if n > 0 {
+					sb.WriteString(", ")
+				}
+
+				key, _ := dec.Token()
+
+				sb.WriteString(jsonPropertyName(key.(string)) + ": ")
+				writeJSONValue(sb, dec)
+			}
+
+			sb.WriteByte('}')
+		} else {
+			sb.WriteByte('[')
+
+			for n := 0; dec.More(); n++ {
+				if n > 0 {
+					sb.WriteString(", ")
+				}
+
+				writeJSONValue(sb, dec)
+			}
+
+			sb.WriteByte(']')
+		}
+
+		dec.Token()
+	case string:
+		sb.WriteString(jsonString(tk))
+	case json.Number:
+		sb.WriteString(tk.String())
+	case bool:
+		if tk {
+			sb.WriteString("true")
+		} else {
+			sb.WriteString("false")
+		}
+	default:
+		sb.WriteString("null")
+	}
+}
+
+func jsonString(str string) string {
+	b, _ := json.Marshal(str)
+
+	return string(b)
+}
+
+func jsonPropertyName(key string) string {
+	if key == "__proto__" { // a literal __proto__ property would set the prototype
+		return "[" + jsonString(key) + "]"
+	}
+
+	return jsonString(key)
+}
+
+func isIdentifier(name string) bool {
+	if _, reserved := reservedWords[name]; reserved || name == "" {
+		return false
+	}
+
+	for n, r := range name {
+		if !unicode.IsLetter(r) && r != '$' && r != '_' && (n == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var reservedWords = map[string]struct{}{
+	"arguments": {}, "await": {}, "break": {}, "case": {}, "catch": {}, "class": {}, "const": {}, "continue": {}, "debugger": {}, "default": {}, "delete": {}, "do": {}, "else": {}, "enum": {}, "eval": {}, "export": {}, "extends": {}, "false": {}, "finally": {}, "for": {}, "function": {}, "if": {}, "implements": {}, "import": {}, "in": {}, "instanceof": {}, "interface": {}, "let": {}, "new": {}, "null": {}, "package": {}, "private": {}, "protected": {}, "public": {}, "return": {}, "static": {}, "super": {}, "switch": {}, "this": {}, "throw": {}, "true": {}, "try": {}, "typeof": {}, "var": {}, "void": {}, "while": {}, "with": {}, "yield": {},
+}
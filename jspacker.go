@@ -13,30 +13,78 @@ import (
 type config struct {
 	filesToDo     []string
 	filesDone     map[string]*dependency
-	resolveURL    func(string, string) string
-	loader        func(string) (*javascript.Module, error)
+	resolveURL    func(string, string) (string, error)
+	loader        func(string, string) (*javascript.Module, error)
 	bare          bool
 	parseDynamic  bool
 	primary       bool
+	treeShake     bool
 	nextID        uint
 	exportAllFrom [][2]*dependency
 	moduleItems   []javascript.ModuleItem
+	items         []*moduleItem
+	shakeRoots    []*javascript.Token
+	reachable     map[string]struct{}
+	sourceMap     *SourceMapper
+	splitDir      string
+	splitFn       func(string, *javascript.Module)
+	dynamicURLs   []*javascript.Token
+	chunks        []*chunk
+	strictCycles  bool
+	cycleFn       func([]string)
+	cycles        [][]*dependency
+	workers       int
+	prefetcher    *prefetcher
+	cache         *Cache
+	format        OutputFormat
+	globalName    string
+	exportsFile   *dependency
+	metafile      *Metafile
+	maxErrors     int
+	warnFn        func(Warning)
+	minify        bool
+	errors        []error
 	dependency
 }
 
 // Package packages up multiple JavaScript modules into a single file, renaming
 // bindings to simulate imports.
+//
+// Modules without any import or export declarations that reference the
+// require, module, or exports globals are treated as CommonJS modules. These
+// are wrapped in a function and have their static require calls resolved as
+// imports. The module.exports value is their default export, with its
+// properties available as named exports.
+//
+// Errors in individual modules do not stop processing; instead, every error
+// found, up to the limit set by MaxErrors, is returned joined together. Errors
+// that can be attributed to a position in a module are of type *Error.
 func Package(opts ...Option) (*javascript.Module, error) {
 	c, err := createConfig(opts)
 	if err != nil {
 		return nil, err
 	}
 
+	defer c.stopPrefetch()
+
 	for _, url := range c.filesToDo {
 		if !strings.HasPrefix(url, "/") {
 			return nil, fmt.Errorf("%w: %s", ErrInvalidURL, url)
-		} else if _, err := c.dependency.addImport(c.dependency.RelTo(url), c.primary); err != nil {
-			return nil, err
+		} else if url, err := c.dependency.RelTo(url); err != nil {
+			if err := c.addError(err); err != nil {
+				return nil, c.joinErrors()
+			}
+		} else if d, err := c.dependency.addImport(url, "", c.primary && c.format == FormatESM); err != nil {
+			if err := c.addError(err); err != nil {
+				return nil, c.joinErrors()
+			}
+		} else {
+			d.entry = true
+
+			if c.primary && c.format != FormatESM && c.exportsFile == nil {
+				d.requireNamespace = true
+				c.exportsFile = d
+			}
 		}
 	}
 
@@ -51,6 +99,7 @@ func Package(opts ...Option) (*javascript.Module, error) {
 					eaf[0].exports[export] = &importBinding{
 						dependency: eaf[1],
 						binding:    export,
+						star:       true,
 					}
 					changed = true
 				}
@@ -58,9 +107,36 @@ func Package(opts ...Option) (*javascript.Module, error) {
 		}
 	}
 
-	if err := c.dependency.resolveImports(); err != nil {
+	if err := c.dependency.resolveImports(); err != nil || len(c.errors) > 0 {
+		return nil, c.joinErrors()
+	}
+
+	if c.warnFn != nil {
+		c.warnExportCollisions()
+		c.warnUnusedModules()
+	}
+
+	if err := c.orderItems(); err != nil {
 		return nil, err
-	} else if err := c.makeLoader(); err != nil {
+	}
+
+	if c.treeShake {
+		c.shake()
+	}
+
+	if c.splitFn != nil {
+		if err := c.split(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range c.items {
+		if item.keep && item.dependency.chunk == nil {
+			c.moduleItems = append(c.moduleItems, item.ModuleItem)
+		}
+	}
+
+	if err := c.makeLoader(); err != nil {
 		return nil, err
 	}
 
@@ -68,6 +144,30 @@ func Package(opts ...Option) (*javascript.Module, error) {
 		c.moduleItems = slices.Insert(c.moduleItems, 0, locationOrigin())
 	}
 
+	if err := c.wrapFormat(); err != nil {
+		return nil, err
+	}
+
+	if c.sourceMap != nil {
+		c.sourceMap.record("", c.moduleItems, c.items)
+
+		for _, ch := range c.chunks {
+			c.sourceMap.record(ch.url, ch.module.ModuleListItems, ch.items)
+		}
+	}
+
+	if c.minify {
+		c.minifyOutput()
+	}
+
+	if c.metafile != nil {
+		c.setMetafile()
+	}
+
+	for _, ch := range c.chunks {
+		c.splitFn(ch.url, ch.module)
+	}
+
 	return &javascript.Module{
 		ModuleListItems: c.moduleItems,
 	}, nil
@@ -79,7 +179,7 @@ func createConfig(opts []Option) (*config, error) {
 		dependency: dependency{
 			requires: make(map[string]*dependency),
 		},
-		resolveURL: RelTo,
+		resolveURL: relTo,
 	}
 
 	if c.loader == nil {
@@ -88,7 +188,7 @@ func createConfig(opts []Option) (*config, error) {
 			return nil, fmt.Errorf("error getting current working directory: %w", err)
 		}
 
-		c.loader = OSLoad(base)
+		c.loader = OSTypedLoad(base)
 	}
 
 	c.config = c
@@ -99,6 +199,23 @@ func createConfig(opts []Option) (*config, error) {
 
 	if len(c.filesToDo) == 0 {
 		return nil, ErrNoFiles
+	} else if c.globalName != "" && !isIdentifier(c.globalName) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGlobalName, c.globalName)
+	} else if c.minify && c.sourceMap != nil {
+		return nil, ErrMinifySourceMap
+	} else if c.format == FormatIIFE && c.globalName != "" && !c.primary {
+		return nil, ErrGlobalNoExports
+	} else if c.splitFn != nil && c.format != FormatESM {
+		return nil, ErrSplitFormat
+	}
+
+	if c.workers > 1 {
+		c.prefetcher = &prefetcher{
+			config:  c,
+			sem:     make(chan struct{}, c.workers),
+			done:    make(chan struct{}),
+			modules: make(map[string]*pendingModule),
+		}
 	}
 
 	return c, nil
@@ -1,10 +1,15 @@
 package jspacker
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"vimagination.zapto.org/javascript"
 	"vimagination.zapto.org/parser"
@@ -218,6 +223,55 @@ func TestPackage(t *testing.T) {
 			"const a_ = {}, b_ = {get default() {\nreturn b_default;\n}};\n\nObject.defineProperty(globalThis, include, {value: (() => {\nconst imports = new Map([[\"/a.js\", a_], [\"/b.js\", b_]]);\nreturn url => (imports.get(url) ?? import(url));\n})()});\n\nfunction b_default() {\nb_default();\n}\n\nconsole.log(b_default);",
 			[]Option{File("/a.js")},
 		},
+		{ // 24
+			loader{
+				"/a.js": "import {c} from './b.js'; console.log(c)",
+				"/b.js": "export const c = 1, d = 2;\nexport function e() {}\nconsole.log(3);",
+			},
+			"const b_c = 1, b_d = 2;\n\nconsole.log(3);\n\nconsole.log(b_c);",
+			[]Option{File("/a.js"), NoExports, TreeShake},
+		},
+		{ // 25
+			loader{
+				"/a.js": "import {c} from './b.js'; const f = 1; console.log(c)",
+				"/b.js": "export const c = 1;\nexport function e() {}",
+			},
+			"const a_ = {}, b_ = {get c() {\nreturn b_c;\n}};\n\nObject.defineProperty(globalThis, include, {value: (() => {\nconst imports = new Map([[\"/a.js\", a_], [\"/b.js\", b_]]);\nreturn url => (imports.get(url) ?? import(url));\n})()});\n\nconst b_c = 1;\n\nconsole.log(b_c);",
+			[]Option{File("/a.js"), TreeShake},
+		},
+		{ // 26
+			loader{
+				"/a.js": "console.log(1);\nimport {b} from './b.js';\nconsole.log(b);",
+				"/b.js": "export const b = 2;\nconsole.log(3);",
+			},
+			"const b_b = 2;\n\nconsole.log(3);\n\nconsole.log(1);\n\nconsole.log(b_b);",
+			[]Option{File("/a.js"), NoExports},
+		},
+		{ // 27
+			loader{
+				"/a.js": "console.log(1);\nimport './b.js';\nconsole.log(2);\nimport './c.js';",
+				"/b.js": "console.log(3);\nimport './c.js';",
+				"/c.js": "console.log(4);",
+			},
+			"console.log(4);\n\nconsole.log(3);\n\nconsole.log(1);\n\nconsole.log(2);",
+			[]Option{File("/a.js"), NoExports},
+		},
+		{ // 28
+			loader{
+				"/a.js": "console.log(1);\nimport './b.js';",
+				"/b.js": "console.log(2);\nimport './a.js';",
+			},
+			"console.log(2);\n\nconsole.log(1);",
+			[]Option{File("/a.js"), NoExports},
+		},
+		{ // 29
+			loader{
+				"/a.js": "import {c} from './b.js'; console.log(c)",
+				"/b.js": "export const c = 1;\nconst d = {...c};\nconst e = {[c]: 1};\nconst f = {g: 1};\nclass H {[c]() {}}\nclass I {j = c;}\nclass K {[c] = 1;}",
+			},
+			"const b_c = 1;\n\nconst b_d = {...b_c};\n\nconst b_e = {[b_c]: 1};\n\nclass b_H {\n[b_c]() {}\n}\n\nclass b_K {\n[b_c] = 1;\n}\n\nconsole.log(b_c);",
+			[]Option{File("/a.js"), NoExports, TreeShake},
+		},
 	} {
 		s, err := Package(append(test.Options, Loader(test.Input.load))...)
 		if err != nil {
@@ -229,3 +283,1197 @@ func TestPackage(t *testing.T) {
 		}
 	}
 }
+
+func TestChunkName(t *testing.T) {
+	for n, test := range [...]struct {
+		URL, Name string
+	}{
+		{ // 1
+			"/b.js", "b",
+		},
+		{ // 2
+			"/lib/util.ts", "lib-util",
+		},
+		{ // 3
+			"/c/index", "c-index",
+		},
+	} {
+		if name := chunkName(test.URL); name != test.Name {
+			t.Errorf("test %d: expecting name %q, got %q", n+1, test.Name, name)
+		}
+	}
+}
+
+func TestSplitDynamic(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  loader
+		Chunks map[string]string
+		Main   string
+	}{
+		{ // 1
+			loader{
+				"/a.js": "import('./b.js').then(b => console.log(b.c));",
+				"/b.js": "export const c = 1;",
+			},
+			map[string]string{
+				"/chunks/chunk-b.js": "const b_c = 1;\n\nexport {b_c as c};",
+			},
+			"include(\"/chunks/chunk-b.js\")",
+		},
+		{ // 2
+			loader{
+				"/a.js": "import('./b.js'); import('./c.js');",
+				"/b.js": "import {d} from './d.js'; export const b = d;",
+				"/c.js": "import {d} from './d.js'; export const c = d;",
+				"/d.js": "export const d = 1;",
+			},
+			map[string]string{
+				"/chunks/chunk-b.js":   "import {c_d} from \"/chunks/chunk-b-c.js\";\n\nconst b_b = c_d;\n\nexport {b_b as b};",
+				"/chunks/chunk-c.js":   "import {c_d} from \"/chunks/chunk-b-c.js\";\n\nconst d_c = c_d;\n\nexport {d_c as c};",
+				"/chunks/chunk-b-c.js": "const c_d = 1;\n\nexport {c_d};",
+			},
+			"include(\"/chunks/chunk-c.js\")",
+		},
+		{ // 3
+			loader{
+				"/a.js":       "import('./lib/b.js'); import('./lib/b.ts'); import('./c/index.js');",
+				"/lib/b.js":   "export const b = 1;",
+				"/lib/b.ts":   "export const b = 2;",
+				"/c/index.js": "export const c = 3;",
+			},
+			map[string]string{
+				"/chunks/chunk-c-index.js": "const d_c = 3;\n\nexport {d_c as c};",
+				"/chunks/chunk-lib-b.js":   "const b_b = 1;\n\nexport {b_b as b};",
+				"/chunks/chunk-lib-b-2.js": "const c_b = 2;\n\nexport {c_b as b};",
+			},
+			"include(\"/chunks/chunk-lib-b-2.js\")",
+		},
+	} {
+		chunks := make(map[string]string)
+
+		s, err := Package(File("/a.js"), Loader(test.Input.load), SplitDynamic("/chunks", func(url string, m *javascript.Module) {
+			chunks[url] = strings.ReplaceAll(fmt.Sprintf("%s", m), "\t", "")
+		}))
+		if err != nil {
+			t.Fatalf("test %d: unexpected err: %s", n+1, err)
+		}
+
+		if !reflect.DeepEqual(chunks, test.Chunks) {
+			t.Errorf("test %d: expecting chunks: %q\ngot: %q", n+1, test.Chunks, chunks)
+		}
+
+		if output := fmt.Sprintf("%s", s); !strings.Contains(output, test.Main) {
+			t.Errorf("test %d: expecting output to contain %q, got: %q", n+1, test.Main, output)
+		}
+	}
+}
+
+func TestCycles(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  loader
+		Cycles [][]string
+		Err    error
+	}{
+		{ // 1
+			loader{
+				"/a.js": "import './b.js';",
+				"/b.js": "console.log(1);",
+			},
+			nil,
+			nil,
+		},
+		{ // 2
+			loader{
+				"/a.js": "import {b} from './b.js'; export const a = 1; console.log(b());",
+				"/b.js": "import {a} from './a.js'; export function b() { return a; }",
+			},
+			[][]string{{"/a.js", "/b.js", "/a.js"}},
+			nil,
+		},
+		{ // 3
+			loader{
+				"/a.js": "import './b.js'; export class A {}",
+				"/b.js": "import './c.js';",
+				"/c.js": "import {A} from './a.js'; export class C extends A {}",
+			},
+			[][]string{{"/a.js", "/b.js", "/c.js", "/a.js"}},
+			ErrCircularDependency,
+		},
+		{ // 4
+			loader{
+				"/a.js": "import './b.js'; export const x = 1;",
+				"/b.js": "import {x} from './c.js'; console.log(x);",
+				"/c.js": "export {x} from './a.js';",
+			},
+			[][]string{{"/a.js", "/b.js", "/c.js", "/a.js"}},
+			ErrCircularDependency,
+		},
+	} {
+		var cycles [][]string
+
+		_, err := Package(File("/a.js"), Loader(test.Input.load), StrictCycles, ReportCycles(func(urls []string) {
+			cycles = append(cycles, urls)
+		}))
+		if !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+
+		if !reflect.DeepEqual(cycles, test.Cycles) {
+			t.Errorf("test %d: expecting cycles %q, got %q", n+1, test.Cycles, cycles)
+		}
+	}
+}
+
+func TestExportSource(t *testing.T) {
+	var (
+		a = &dependency{url: "/a.js", imports: make(map[string]*importBinding)}
+		b = &dependency{url: "/b.js", imports: make(map[string]*importBinding)}
+		c = &dependency{url: "/c.js", imports: make(map[string]*importBinding)}
+	)
+
+	a.exports = map[string]*importBinding{
+		"x": {dependency: b, binding: "y"},
+		"z": {dependency: c, binding: "z"},
+	}
+	b.exports = map[string]*importBinding{
+		"y": {binding: "local"},
+		"z": {binding: "imported"},
+	}
+	b.imports["imported"] = &importBinding{dependency: c, binding: "w"}
+	c.exports = map[string]*importBinding{
+		"w": {binding: "w"},
+		"z": {dependency: a, binding: "z"},
+	}
+
+	for n, test := range [...]struct {
+		Dependency *dependency
+		Binding    string
+		Source     *dependency
+		Output     string
+	}{
+		{ // 1
+			a, "x", b, "local",
+		},
+		{ // 2
+			b, "z", c, "w",
+		},
+		{ // 3
+			a, "missing", a, "missing",
+		},
+		{ // 4
+			a, "z", nil, "",
+		},
+	} {
+		if source, output := test.Dependency.exportSource(test.Binding); source != test.Source || output != test.Output {
+			t.Errorf("test %d: expecting source %p (%q), got %p (%q)", n+1, test.Source, test.Output, source, output)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	for n, test := range [...]struct {
+		Input loader
+		Err   Error
+	}{
+		{ // 1
+			loader{
+				"/a.js": "import './b.js';",
+				"/b.js": "\nimport {c} from './c.js';\nconsole.log(c);",
+				"/c.js": "export const d = 1;",
+			},
+			Error{
+				Importer: "/b.js",
+				Imported: "/c.js",
+				Binding:  "c",
+				Line:     2,
+				Column:   9,
+				Chain:    []string{"/a.js", "/b.js"},
+				Err:      ErrInvalidExport,
+			},
+		},
+		{ // 2
+			loader{
+				"/a.js": "import './b.js';",
+				"/b.js": "import './c.js';",
+			},
+			Error{
+				Importer: "/b.js",
+				Imported: "/c.js",
+				Line:     1,
+				Column:   8,
+				Chain:    []string{"/a.js", "/b.js"},
+				Err:      os.ErrNotExist,
+			},
+		},
+	} {
+		var e *Error
+
+		if _, err := Package(File("/a.js"), Loader(test.Input.load)); !errors.As(err, &e) {
+			t.Errorf("test %d: expecting *Error, got %v", n+1, err)
+		} else if !errors.Is(err, test.Err.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err.Err, err)
+		} else if e.Err = test.Err.Err; !reflect.DeepEqual(*e, test.Err) {
+			t.Errorf("test %d: expecting error %#v, got %#v", n+1, test.Err, *e)
+		}
+	}
+}
+
+func TestDynamicImportError(t *testing.T) {
+	var e *Error
+
+	expected := Error{
+		Importer: "/a.js",
+		Imported: "/missing.js",
+		Line:     1,
+		Column:   8,
+		Chain:    []string{"/a.js"},
+		Err:      os.ErrNotExist,
+	}
+
+	if _, err := Package(File("/a.js"), ParseDynamic, Loader(loader{"/a.js": "import('./missing.js');"}.load)); !errors.As(err, &e) {
+		t.Errorf("expecting *Error, got %v", err)
+	} else if !errors.Is(err, expected.Err) {
+		t.Errorf("expecting error %v, got %v", expected.Err, err)
+	} else if e.Err = expected.Err; !reflect.DeepEqual(*e, expected) {
+		t.Errorf("expecting error %#v, got %#v", expected, *e)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := loader{
+		"/a.js": "import {b} from './b.js'; import './c.js'; import {d} from './d.js'; console.log(b, d);",
+		"/b.js": "export const c = 1;",
+		"/d.js": "import './e.js'; export const d = 1;",
+	}
+
+	for n, test := range [...]struct {
+		Options  []Option
+		Imported []string
+		TooMany  bool
+	}{
+		{ // 1
+			nil,
+			[]string{"/c.js", "/e.js", "/b.js"},
+			false,
+		},
+		{ // 2
+			[]Option{MaxErrors(2)},
+			[]string{"/c.js", "/e.js"},
+			true,
+		},
+		{ // 3
+			[]Option{MaxErrors(5)},
+			[]string{"/c.js", "/e.js", "/b.js"},
+			false,
+		},
+	} {
+		_, err := Package(append(test.Options, File("/a.js"), Loader(input.load))...)
+
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			t.Errorf("test %d: expecting joined errors, got %v", n+1, err)
+
+			continue
+		}
+
+		var imported []string
+
+		for _, err := range joined.Unwrap() {
+			if e, ok := err.(*Error); ok {
+				imported = append(imported, e.Imported)
+			}
+		}
+
+		if !reflect.DeepEqual(imported, test.Imported) {
+			t.Errorf("test %d: expecting errors importing %v, got %v", n+1, test.Imported, imported)
+		} else if tooMany := errors.Is(err, ErrTooManyErrors); tooMany != test.TooMany {
+			t.Errorf("test %d: expecting too many errors to be %v, got %v", n+1, test.TooMany, tooMany)
+		}
+	}
+}
+
+func TestFailedReExport(t *testing.T) {
+	_, err := Package(File("/a.js"), Loader(loader{
+		"/a.js": "import {x} from './b.js'; import {y} from './c.js'; import {z} from './d.js'; console.log(x, y, z);",
+		"/b.js": "export {x} from './missing.js';",
+		"/c.js": "export * from './missing2.js';",
+		"/d.js": "export {x as z} from './b.js';",
+	}.load))
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("expecting joined errors, got %v", err)
+	}
+
+	var imported []string
+
+	for _, err := range joined.Unwrap() {
+		if e, ok := err.(*Error); ok {
+			imported = append(imported, e.Imported)
+		} else {
+			t.Errorf("expecting error of type *Error, got %v", err)
+		}
+	}
+
+	if expected := []string{"/missing.js", "/missing2.js"}; !reflect.DeepEqual(imported, expected) {
+		t.Errorf("expecting errors importing %v, got %v", expected, imported)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	var warnings []Warning
+
+	if _, err := Package(File("/a.js"), ParseDynamic, Warnings(func(w Warning) {
+		warnings = append(warnings, w)
+	}), Loader(loader{
+		"/a.js": "import {b, c} from './b.js';\nimport './d.js';\nexport * from './e.js';\nexport * from './f.js';\nimport(b);\neval('c');",
+		"/b.js": "export const b = 1, c = 2;",
+		"/d.js": "export const d = 1;",
+		"/e.js": "export const e = 1;",
+		"/f.js": "export const e = 2;",
+	}.load)); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	expected := []Warning{
+		{Kind: WarnUnusedImport, URL: "/a.js", Line: 1, Column: 12, Message: "unused import c from /b.js"},
+		{Kind: WarnDirectEval, URL: "/a.js", Line: 6, Column: 1, Message: "direct eval may reference renamed bindings"},
+		{Kind: WarnDynamicImport, URL: "/a.js", Line: 5, Column: 8, Message: "dynamic import with a non-literal specifier cannot be resolved"},
+		{Kind: WarnExportCollision, URL: "/a.js", Message: "export * of e from /f.js is ignored, as it is also exported from /e.js"},
+		{Kind: WarnUnusedModule, URL: "/a.js", Message: "none of the exports of /d.js are used"},
+	}
+
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expecting warnings %v, got %v", expected, warnings)
+	}
+}
+
+func TestWarnUnusedModuleImporters(t *testing.T) {
+	var warnings []Warning
+
+	if _, err := Package(File("/a.js"), Warnings(func(w Warning) {
+		if w.Kind == WarnUnusedModule {
+			warnings = append(warnings, w)
+		}
+	}), Loader(loader{
+		"/a.js": "import './b.js';\nimport './c.js';",
+		"/b.js": "import './d.js';\nexport const b = 1;",
+		"/c.js": "import './d.js';\nexport const c = 1;",
+		"/d.js": "export const d = 1;",
+	}.load)); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	expected := []Warning{
+		{Kind: WarnUnusedModule, URL: "/a.js", Message: "none of the exports of /b.js are used"},
+		{Kind: WarnUnusedModule, URL: "/a.js", Message: "none of the exports of /c.js are used"},
+		{Kind: WarnUnusedModule, URL: "/b.js", Message: "none of the exports of /d.js are used"},
+		{Kind: WarnUnusedModule, URL: "/c.js", Message: "none of the exports of /d.js are used"},
+	}
+
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expecting warnings %v, got %v", expected, warnings)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	for n, test := range [...]struct {
+		Input, Output string
+	}{
+		{ // 1
+			Input:  "const a = 60 * 60, b = \"a\" + \"b\";\nconsole.log(a, b);",
+			Output: "const a=3600,b=\"ab\";console.log(a,b);",
+		},
+		{ // 2
+			Input:  "function fn(longName) {\n\tconst other = longName + 1;\n\treturn other;\n\tconsole.log(other);\n}\nconsole.log(fn(2));",
+			Output: "function a(b){const c=b+1;return c}console.log(a(2));",
+		},
+		{ // 3
+			Input:  "function f() {\n\tif (false) {\n\t\treturn 1;\n\t}\n\tlet value = 2;\n\treturn {value};\n}\nconsole.log(f());",
+			Output: "function a(){let b=2;return{value:b}}console.log(a());",
+		},
+		{ // 4
+			Input:  "const longName = 1;\neval(\"longName\");",
+			Output: "const a_longName=1;eval(\"longName\");",
+		},
+		{ // 5
+			Input:  "const longName = 1;\nconsole.log(longName);\nfunction f() {\n\tconst a = 2;\n\treturn longName + a;\n}\nconsole.log(f());",
+			Output: "const a=1;console.log(a);function b(){const c=2;return a+c}console.log(b());",
+		},
+		{ // 6
+			Input:  "function f(obj) {\n\tlet value;\n\t({value} = obj);\n\treturn value;\n}\nconsole.log(f({value: 1}));",
+			Output: "function a(c){let b;({value:b}=c);return b}console.log(a({value:1}));",
+		},
+	} {
+		m, err := Package(File("/a.js"), NoExports, Minify, Loader(loader{"/a.js": test.Input}.load))
+		if err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+
+			continue
+		}
+
+		var sb strings.Builder
+
+		if err := PrintMinified(&sb, m); err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+		} else if output := sb.String(); output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+
+	if _, err := Package(File("/a.js"), Minify, SourceMap(new(SourceMapper)), Loader(loader{"/a.js": ""}.load)); !errors.Is(err, ErrMinifySourceMap) {
+		t.Errorf("expecting error %v, got %v", ErrMinifySourceMap, err)
+	}
+}
+
+func TestPrintMinified(t *testing.T) {
+	for n, test := range [...]struct {
+		Input, Output string
+	}{
+		{ // 1
+			Input:  "a + +b;",
+			Output: "a+ +b;",
+		},
+		{ // 2
+			Input:  "a - -b;",
+			Output: "a- -b;",
+		},
+		{ // 3
+			Input:  "/re/ in x;",
+			Output: "/re/ in x;",
+		},
+		{ // 4
+			Input:  "function f() {\n\tif (a);\n}",
+			Output: "function f(){if(a);}",
+		},
+		{ // 5
+			Input:  "function f() {\n\tg(a);\n}",
+			Output: "function f(){g(a)}",
+		},
+		{ // 6
+			Input:  "async function f() {\n\tfor await (const x of y);\n}",
+			Output: "async function f(){for await(const x of y);}",
+		},
+		{ // 7
+			Input:  "function f() {\n\ta: ;\n}",
+			Output: "function f(){a:;}",
+		},
+	} {
+		tk := parser.NewStringTokeniser(test.Input)
+
+		m, err := javascript.ParseModule(&tk)
+		if err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+
+			continue
+		}
+
+		var sb strings.Builder
+
+		if err := PrintMinified(&sb, m); err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+		} else if output := sb.String(); output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestNeedsSpace(t *testing.T) {
+	for n, test := range [...]struct {
+		Last  parser.Token
+		Next  string
+		Space bool
+	}{
+		{ // 1
+			Last:  parser.Token{Type: javascript.TokenPunctuator, Data: "+"},
+			Next:  "+",
+			Space: true,
+		},
+		{ // 2
+			Last:  parser.Token{Type: javascript.TokenPunctuator, Data: "-"},
+			Next:  "-",
+			Space: true,
+		},
+		{ // 3
+			Last:  parser.Token{Type: javascript.TokenPunctuator, Data: "+"},
+			Next:  "-",
+			Space: false,
+		},
+		{ // 4
+			Last:  parser.Token{Type: javascript.TokenRegularExpressionLiteral, Data: "/re/"},
+			Next:  "in",
+			Space: true,
+		},
+		{ // 5
+			Last:  parser.Token{Type: javascript.TokenNumericLiteral, Data: "1"},
+			Next:  ".",
+			Space: true,
+		},
+		{ // 6
+			Last:  parser.Token{Type: javascript.TokenNumericLiteral, Data: "1.5"},
+			Next:  ".",
+			Space: false,
+		},
+		{ // 7
+			Last:  parser.Token{Type: javascript.TokenIdentifier, Data: "a"},
+			Next:  ".",
+			Space: false,
+		},
+		{ // 8
+			Last:  parser.Token{Type: javascript.TokenKeyword, Data: "return"},
+			Next:  "a",
+			Space: true,
+		},
+		{ // 9
+			Last:  parser.Token{Type: javascript.TokenKeyword, Data: "return"},
+			Next:  "\"a\"",
+			Space: false,
+		},
+		{ // 10
+			Last:  parser.Token{Type: javascript.TokenPunctuator, Data: "--"},
+			Next:  ">",
+			Space: true,
+		},
+	} {
+		if space := needsSpace(test.Last, test.Next); space != test.Space {
+			t.Errorf("test %d: expecting space %v, got %v", n+1, test.Space, space)
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	input := loader{
+		"/a.js":   "import {b} from './b.js'; import {c} from './c.js'; export * from './d.js'; console.log(b, c);",
+		"/b.js":   "import {d} from './d.js'; export const b = d + 1;",
+		"/c.js":   "import {e} from './e/e.js'; export const c = e + 2;",
+		"/d.js":   "import {c} from './c.js'; export const d = 3; export function f() { return c; }",
+		"/e/e.js": "export * as e from '../b.js';",
+	}
+
+	expected, err := Package(File("/a.js"), Loader(input.load))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	for n := range 10 {
+		output, err := Package(File("/a.js"), Loader(input.load), Workers(4))
+		if err != nil {
+			t.Fatalf("test %d: unexpected err: %s", n+1, err)
+		}
+
+		if e, o := fmt.Sprintf("%s", expected), fmt.Sprintf("%s", output); e != o {
+			t.Errorf("test %d: expecting output: %q\ngot: %q", n+1, e, o)
+		}
+	}
+}
+
+func TestWorkersStop(t *testing.T) {
+	input := loader{"/a.js": "import './missing.js'; import './b0.js';"}
+
+	for n := range 20 {
+		input[fmt.Sprintf("/b%d.js", n)] = fmt.Sprintf("import './b%d.js';", n+1)
+	}
+
+	var (
+		mu       sync.Mutex
+		returned bool
+		late     []string
+	)
+
+	load := func(url string) (*javascript.Module, error) {
+		mu.Lock()
+		if returned {
+			late = append(late, url)
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		return input.load(url)
+	}
+
+	if _, err := Package(File("/a.js"), Loader(load), Workers(4), MaxErrors(1)); !errors.Is(err, ErrTooManyErrors) {
+		t.Fatalf("expecting error %v, got %v", ErrTooManyErrors, err)
+	}
+
+	mu.Lock()
+	returned = true
+	mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(late) > 0 {
+		t.Errorf("expecting no loads after Package returned, got %v", late)
+	}
+}
+
+func TestFSLoad(t *testing.T) {
+	var (
+		fsys = fstest.MapFS{
+			"a.js":   {Data: []byte("import {b} from './b.js'; import {c} from './c/c.js'; console.log(b, c);")},
+			"b.ts":   {Data: []byte("export const b: number = 1;")},
+			"c/c.js": {Data: []byte("export const c = 2;")},
+		}
+		sources = make(map[string]string)
+	)
+
+	s, err := Package(File("/a.js"), NoExports, Loader(FSLoad(fsys, SourceNames(func(url, source string) {
+		sources[url] = source
+	}))))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	const expected = "const b_b = 1;\n\nconst c_c = 2;\n\nconsole.log(b_b, c_c);"
+
+	if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != expected {
+		t.Errorf("expecting output: %q\ngot: %q", expected, output)
+	}
+
+	expectedSources := map[string]string{
+		"/a.js":   "/a.js",
+		"/b.js":   "/b.ts",
+		"/c/c.js": "/c/c.js",
+	}
+
+	if !reflect.DeepEqual(sources, expectedSources) {
+		t.Errorf("expecting sources %v, got %v", expectedSources, sources)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := loader{
+		"/a.js": "import {y} from './b.js'; export const x = y;",
+		"/b.js": "export const y = 1;",
+	}
+
+	for n, test := range [...]struct {
+		Options []Option
+		Output  string
+	}{
+		{ // 1
+			[]Option{Format(FormatIIFE, "")},
+			"(() => {\n\"use strict\";\nconst b_y = 1;\nconst a_x = b_y;\n})();",
+		},
+		{ // 2
+			[]Option{Format(FormatIIFE, "Lib"), PrimaryExports},
+			"var Lib = (() => {\n\"use strict\";\nconst a_ = {get x() {\nreturn a_x;\n}};\nconst b_y = 1;\nconst a_x = b_y;\nreturn a_;\n})();",
+		},
+		{ // 3
+			[]Option{Format(FormatCJS, ""), PrimaryExports},
+			"\"use strict\";\n\nconst a_ = {get x() {\nreturn a_x;\n}};\n\nconst b_y = 1;\n\nconst a_x = b_y;\n\nmodule.exports = a_;",
+		},
+	} {
+		s, err := Package(append(test.Options, File("/a.js"), NoExports, Loader(input.load))...)
+		if err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+		} else if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != test.Output {
+			t.Errorf("test %d: expecting output: %q\ngot: %q", n+1, test.Output, output)
+		}
+	}
+
+	if _, err := Package(File("/a.js"), Format(FormatUMD, "a-b"), Loader(input.load)); !errors.Is(err, ErrInvalidGlobalName) {
+		t.Errorf("expecting error %v, got %v", ErrInvalidGlobalName, err)
+	}
+
+	if _, err := Package(File("/a.js"), Format(FormatIIFE, "Lib"), Loader(input.load)); !errors.Is(err, ErrGlobalNoExports) {
+		t.Errorf("expecting error %v, got %v", ErrGlobalNoExports, err)
+	}
+
+	if _, err := Package(File("/a.js"), Format(FormatCJS, ""), SplitDynamic("/chunks", func(string, *javascript.Module) {}), Loader(input.load)); !errors.Is(err, ErrSplitFormat) {
+		t.Errorf("expecting error %v, got %v", ErrSplitFormat, err)
+	}
+}
+
+func TestFormatTopLevelAwait(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Format OutputFormat
+		Err    error
+	}{
+		{ // 1
+			"await Promise.resolve();",
+			FormatIIFE,
+			ErrTopLevelAwait,
+		},
+		{ // 2
+			"for await (const x of []);",
+			FormatUMD,
+			ErrTopLevelAwait,
+		},
+		{ // 3
+			"if (true) {\n\tconsole.log(await 1);\n}",
+			FormatCJS,
+			ErrTopLevelAwait,
+		},
+		{ // 4
+			"await Promise.resolve();",
+			FormatESM,
+			nil,
+		},
+		{ // 5
+			"async function f() {\n\tawait f();\n}\n\nconst g = async () => await f();",
+			FormatIIFE,
+			nil,
+		},
+		{ // 6
+			"class A {\n\tasync b() {\n\t\tawait 1;\n\t}\n}",
+			FormatIIFE,
+			nil,
+		},
+	} {
+		if _, err := Package(File("/a.js"), Format(test.Format, ""), Loader(loader{"/a.js": test.Input}.load)); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+	}
+}
+
+func TestSpliceBodyInvalidItem(t *testing.T) {
+	if err := spliceBody(&javascript.Module{}, []javascript.ModuleItem{{ImportDeclaration: &javascript.ImportDeclaration{}}}); !errors.Is(err, ErrInvalidWrappedItem) {
+		t.Errorf("expecting error %v, got %v", ErrInvalidWrappedItem, err)
+	}
+}
+
+func TestCommonJS(t *testing.T) {
+	s, err := Package(File("/a.js"), NoExports, Loader(loader{
+		"/a.js": "import b, {c} from './b.js'; console.log(b, c);",
+		"/b.js": "const d = require('./d.js'); exports.c = d.e;",
+		"/d.js": "export const e = 1;",
+	}.load))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	const expected = "const c_ = {get e() {\nreturn c_e;\n}};\n\nconst c_e = 1;\n\nconst b_module = {exports: {}};\n\n(function(module, exports, require) {\nconst b_d = require(\"/d.js\");\nexports.c = b_d.e;\n}).call(b_module.exports, b_module, b_module.exports, url => ({\"/d.js\": c_})[url]);\n\nconst b_default = b_module.exports;\n\nconst b_c = b_module.exports.c;\n\nconsole.log(b_default, b_c);"
+
+	if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != expected {
+		t.Errorf("expecting output: %q\ngot: %q", expected, output)
+	}
+}
+
+func TestCommonJSModuleExport(t *testing.T) {
+	s, err := Package(File("/a.js"), NoExports, Loader(loader{
+		"/a.js": "import {module} from './b.js'; console.log(module);",
+		"/b.js": "exports.module = this === exports;",
+	}.load))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	const expected = "const b_module = {exports: {}};\n\n(function(module, exports) {\nexports.module = this === exports;\n}).call(b_module.exports, b_module, b_module.exports);\n\nconst b_default = b_module.exports;\n\nconst b_module_ = b_module.exports.module;\n\nconsole.log(b_module_);"
+
+	if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != expected {
+		t.Errorf("expecting output: %q\ngot: %q", expected, output)
+	}
+}
+
+func TestCommonJSShadowedRequire(t *testing.T) {
+	s, err := Package(File("/a.js"), NoExports, Loader(loader{
+		"/a.js": "import b from './b.js'; console.log(b);",
+		"/b.js": "function load(require) {\n\treturn require('./c.js');\n}\nmodule.exports = load(url => url);",
+	}.load))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	const expected = "const b_module = {exports: {}};\n\n(function(module, exports) {\nfunction b_load(b_require) {\nreturn b_require('./c.js');\n}\nmodule.exports = b_load(b_url => b_url);\n}).call(b_module.exports, b_module, b_module.exports);\n\nconst b_default = b_module.exports;\n\nconsole.log(b_default);"
+
+	if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != expected {
+		t.Errorf("expecting output: %q\ngot: %q", expected, output)
+	}
+}
+
+func TestCommonJSNamespace(t *testing.T) {
+	s, err := Package(File("/a.js"), NoExports, Loader(loader{
+		"/a.js": "import * as b from './b.js'; console.log(b.foo);",
+		"/b.js": "exports.foo = 1;",
+	}.load))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", "")
+
+	for n, expected := range [...]string{
+		"const b_ = new Proxy({}, ",
+		"b_module.exports[key]",
+		"Reflect.ownKeys(Object(b_module.exports))",
+		"const a_b = b_;",
+		"console.log(a_b.foo);",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("test %d: expecting output to contain %q, got: %q", n+1, expected, output)
+		}
+	}
+
+	if strings.Contains(output, "get default()") {
+		t.Errorf("expecting namespace to forward module.exports, got: %q", output)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	var m Metafile
+
+	if _, err := Package(File("/a.js"), NoExports, ParseDynamic, Metadata(&m), Loader(loader{
+		"/a.js": "import {b} from './b.js'; import('./c.js'); console.log(b);",
+		"/b.js": "export const b = 1;",
+		"/c.js": "export default 2;",
+	}.load)); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	for n := range m.Modules {
+		if m.Modules[n].Bytes <= 0 || m.Modules[n].GzipBytes <= 0 {
+			t.Errorf("expecting module %s to have a positive size, got %d (%d)", m.Modules[n].URL, m.Modules[n].Bytes, m.Modules[n].GzipBytes)
+		}
+
+		m.Modules[n].Bytes = 0
+		m.Modules[n].GzipBytes = 0
+	}
+
+	expected := Metafile{
+		Modules: []MetaModule{
+			{
+				URL:     "/a.js",
+				Prefix:  "a_",
+				Imports: []MetaImport{{URL: "/b.js"}, {URL: "/c.js", Dynamic: true}},
+				Exports: []string{},
+			},
+			{
+				URL:     "/b.js",
+				Prefix:  "b_",
+				Imports: []MetaImport{},
+				Exports: []string{"b"},
+			},
+			{
+				URL:     "/c.js",
+				Prefix:  "c_",
+				Imports: []MetaImport{},
+				Exports: []string{"default"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expecting metafile %v, got %v", expected, m)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	g, err := Graph(File("/a.js"), Loader(loader{
+		"/a.js": "import {b} from './b.js'; export * from './c.js'; import('./d.js');",
+		"/b.js": "export * from './c.js'; import './c.js'; export const b = 1;",
+		"/c.js": "export const c = 2;",
+		"/d.js": "const e = require('./e.js');",
+		"/e.js": "module.exports = 3;",
+	}.load))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	expected := &ImportGraph{
+		Modules: []GraphModule{
+			{URL: "/a.js", Entry: true},
+			{URL: "/b.js"},
+			{URL: "/c.js"},
+			{URL: "/d.js"},
+			{URL: "/e.js"},
+		},
+		Edges: []GraphEdge{
+			{From: "/a.js", To: "/b.js", Kind: EdgeStatic},
+			{From: "/a.js", To: "/c.js", Kind: EdgeReExport},
+			{From: "/a.js", To: "/d.js", Kind: EdgeDynamic},
+			{From: "/b.js", To: "/c.js", Kind: EdgeStatic},
+			{From: "/b.js", To: "/c.js", Kind: EdgeReExport},
+			{From: "/d.js", To: "/e.js", Kind: EdgeStatic},
+		},
+	}
+
+	if !reflect.DeepEqual(g, expected) {
+		t.Errorf("expecting graph %v, got %v", expected, g)
+	}
+
+	const expectedDOT = "digraph imports {\n\t\"/a.js\" [peripheries=2];\n\t\"/b.js\";\n\t\"/c.js\";\n\t\"/d.js\";\n\t\"/e.js\";\n\t\"/a.js\" -> \"/b.js\";\n\t\"/a.js\" -> \"/c.js\" [style=dashed];\n\t\"/a.js\" -> \"/d.js\" [style=dotted];\n\t\"/b.js\" -> \"/c.js\";\n\t\"/b.js\" -> \"/c.js\" [style=dashed];\n\t\"/d.js\" -> \"/e.js\";\n}\n"
+
+	var sb strings.Builder
+
+	if err := g.WriteDOT(&sb); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	} else if dot := sb.String(); dot != expectedDOT {
+		t.Errorf("expecting DOT: %q\ngot: %q", expectedDOT, dot)
+	}
+}
+
+func TestJSONModule(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.js":        {Data: []byte("import config, {name} from './config.json' with {type: 'json'}; import data from './data.txt' with {type: 'json'}; console.log(config, name, data);")},
+		"b.js":        {Data: []byte("import {name} from './config.json'; console.log(name);")},
+		"config.json": {Data: []byte(`{"name": "x", "a-b": [1, true, null]}`)},
+		"data.txt":    {Data: []byte(`[1, 2]`)},
+	}
+
+	for n, test := range [...]struct {
+		Options []Option
+		Output  string
+	}{
+		{ // 1
+			[]Option{File("/a.js")},
+			"const b_name = \"x\";\n\nconst b_default = {\"name\": b_name, \"a-b\": [1, true, null]};\n\nconst c_default = [1, 2];\n\nconsole.log(b_default, b_name, c_default);",
+		},
+		{ // 2
+			[]Option{File("/b.js"), TreeShake},
+			"const b_name = \"x\";\n\nconsole.log(b_name);",
+		},
+	} {
+		s, err := Package(append(test.Options, NoExports, TypedLoader(FSTypedLoad(fsys)))...)
+		if err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+		} else if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != test.Output {
+			t.Errorf("test %d: expecting output: %q\ngot: %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestAssets(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.js":     {Data: []byte("import icon from './icon.svg'; import data from './data.bin'; import img from './img.png' with {type: 'dataurl'}; console.log(icon, data, img);")},
+		"icon.svg": {Data: []byte("<svg/>")},
+		"data.bin": {Data: []byte{1, 2, 3}},
+		"img.png":  {Data: []byte("abc")},
+	}
+
+	s, err := Package(File("/a.js"), NoExports, TypedLoader(FSTypedLoad(fsys, ExtensionTypes(map[string]string{".svg": "text", ".bin": "bytes"}))))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	const expected = "const b_default = \"<svg/>\";\n\nconst c_default = Uint8Array.from(atob(\"AQID\"), c_c => c_c.charCodeAt(0));\n\nconst d_default = \"data:image/png;base64,YWJj\";\n\nconsole.log(b_default, c_default, d_default);"
+
+	if output := strings.ReplaceAll(fmt.Sprintf("%s", s), "\t", ""); output != expected {
+		t.Errorf("expecting output: %q\ngot: %q", expected, output)
+	}
+
+	if _, err := Package(File("/a.js"), NoExports, TypedLoader(FSTypedLoad(fstest.MapFS{
+		"a.js": {Data: []byte("import a from './b.js' with {type: 'unknown'};")},
+		"b.js": {},
+	}))); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expecting error %v, got %v", ErrUnsupportedType, err)
+	}
+}
+
+func TestMIMEType(t *testing.T) {
+	for n, test := range [...]struct {
+		Name, Output string
+	}{
+		{ // 1
+			"/img.png", "image/png",
+		},
+		{ // 2
+			"/icon.SVG", "image/svg+xml",
+		},
+		{ // 3
+			"/font.woff2", "font/woff2",
+		},
+		{ // 4
+			"/data.bin", "application/octet-stream",
+		},
+		{ // 5
+			"/noext", "application/octet-stream",
+		},
+	} {
+		if output := mimeType(test.Name); output != test.Output {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestNodeResolver(t *testing.T) {
+	resolve := NodeResolver(fstest.MapFS{
+		"node_modules/a/package.json":          {Data: []byte(`{"main": "lib/main.js", "module": "lib/module.js"}`)},
+		"node_modules/b/package.json":          {Data: []byte(`{"main": "main.js"}`)},
+		"node_modules/c/index.js":              {},
+		"node_modules/@s/d/package.json":       {Data: []byte(`{"exports": {".": {"node": "./node.js", "import": "./import.js", "default": "./default.js"}, "./sub": "./lib/sub.js", "./feat/*": "./lib/feat/*.js", "./feat/internal/*": null}}`)},
+		"node_modules/e/package.json":          {Data: []byte(`{"exports": "./e.js"}`)},
+		"node_modules/f/package.json":          {Data: []byte(`{"exports": {"require": "./f.cjs", "default": "./f.js"}}`)},
+		"src/node_modules/a/package.json":      {Data: []byte(`{"main": "inner.js"}`)},
+		"src/deep/node_modules/g/package.json": {Data: []byte(`{"exports": {"./*": "./dist/*"}}`)},
+		"node_modules/h/package.json":          {Data: []byte(`{"main": `)},
+	})
+
+	for n, test := range [...]struct {
+		From, To, Output string
+		Err              error
+	}{
+		{ // 1
+			"/main.js", "./a.js", "/a.js", nil,
+		},
+		{ // 2
+			"/main.js", "/abs.js", "/abs.js", nil,
+		},
+		{ // 3
+			"/main.js", "a", "/node_modules/a/lib/module.js", nil,
+		},
+		{ // 4
+			"/main.js", "b", "/node_modules/b/main.js", nil,
+		},
+		{ // 5
+			"/main.js", "c", "/node_modules/c/index.js", nil,
+		},
+		{ // 6
+			"/main.js", "c/other.js", "/node_modules/c/other.js", nil,
+		},
+		{ // 7
+			"/main.js", "@s/d", "/node_modules/@s/d/import.js", nil,
+		},
+		{ // 8
+			"/main.js", "@s/d/sub", "/node_modules/@s/d/lib/sub.js", nil,
+		},
+		{ // 9
+			"/main.js", "@s/d/feat/x/y", "/node_modules/@s/d/lib/feat/x/y.js", nil,
+		},
+		{ // 10
+			"/main.js", "@s/d/feat/internal/z", "", ErrNotExported,
+		},
+		{ // 11
+			"/main.js", "@s/d/missing", "", ErrNotExported,
+		},
+		{ // 12
+			"/main.js", "e", "/node_modules/e/e.js", nil,
+		},
+		{ // 13
+			"/main.js", "f", "/node_modules/f/f.js", nil,
+		},
+		{ // 14
+			"/src/main.js", "a", "/src/node_modules/a/inner.js", nil,
+		},
+		{ // 15
+			"/src/deep/main.js", "a", "/src/node_modules/a/inner.js", nil,
+		},
+		{ // 16
+			"/src/deep/main.js", "g/h.js", "/src/deep/node_modules/g/dist/h.js", nil,
+		},
+		{ // 17
+			"/main.js", "g", "/g", nil,
+		},
+		{ // 18
+			"/main.js", "h", "", ErrInvalidPackage,
+		},
+	} {
+		if output, err := resolve(test.From, test.To); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestImportMap(t *testing.T) {
+	im := ImportMap{
+		Imports: map[string]string{
+			"lit":             "/vendor/lit/index.js",
+			"lit/":            "/vendor/lit/",
+			"lit/directives/": "/vendor/lit-directives/",
+			"./local.js":      "./remapped.js",
+			"bare":            "vendor/bare.js",
+			"blocked/":        "/not-a-prefix",
+			"none":            "",
+		},
+		Scopes: map[string]map[string]string{
+			"/legacy/": {
+				"lit": "/vendor/lit-1/index.js",
+			},
+			"/legacy/inner/": {
+				"lit/": "/vendor/lit-inner/",
+			},
+		},
+	}
+
+	for n, test := range [...]struct {
+		From, To, Output string
+		OK               bool
+	}{
+		{ // 1
+			"/main.js", "lit", "/vendor/lit/index.js", true,
+		},
+		{ // 2
+			"/main.js", "lit/html.js", "/vendor/lit/html.js", true,
+		},
+		{ // 3
+			"/main.js", "lit/directives/class-map.js", "/vendor/lit-directives/class-map.js", true,
+		},
+		{ // 4
+			"/main.js", "./local.js", "/remapped.js", true,
+		},
+		{ // 5
+			"/sub/main.js", "../local.js", "/remapped.js", true,
+		},
+		{ // 6
+			"/sub/main.js", "./local.js", "", false,
+		},
+		{ // 7
+			"/main.js", "bare", "/vendor/bare.js", true,
+		},
+		{ // 8
+			"/main.js", "blocked/a.js", "", true,
+		},
+		{ // 9
+			"/legacy/main.js", "lit", "/vendor/lit-1/index.js", true,
+		},
+		{ // 10
+			"/legacy/main.js", "lit/html.js", "/vendor/lit/html.js", true,
+		},
+		{ // 11
+			"/legacy/inner/main.js", "lit/html.js", "/vendor/lit-inner/html.js", true,
+		},
+		{ // 12
+			"/legacy/inner/main.js", "lit", "/vendor/lit-1/index.js", true,
+		},
+		{ // 13
+			"/main.js", "other", "", false,
+		},
+		{ // 14
+			"/main.js", "none", "", true,
+		},
+	} {
+		if output, ok := im.Resolve(test.From, test.To); output != test.Output || ok != test.OK {
+			t.Errorf("test %d: expecting %q (%v), got %q (%v)", n+1, test.Output, test.OK, output, ok)
+		}
+	}
+}
+
+func TestImportMapResolver(t *testing.T) {
+	resolve := (&ImportMap{
+		Imports: map[string]string{
+			"lit":      "/vendor/lit/index.js",
+			"blocked/": "/not-a-prefix",
+			"none":     "",
+		},
+	}).Resolver(relTo)
+
+	for n, test := range [...]struct {
+		To, Output string
+		Err        error
+	}{
+		{ // 1
+			"lit", "/vendor/lit/index.js", nil,
+		},
+		{ // 2
+			"./a.js", "/src/a.js", nil,
+		},
+		{ // 3
+			"blocked/a.js", "", ErrBlockedImport,
+		},
+		{ // 4
+			"none", "", ErrBlockedImport,
+		},
+	} {
+		if output, err := resolve("/src/main.js", test.To); output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		} else if !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package jspacker
 
 import (
 	"cmp"
-	"fmt"
 	"iter"
 	"maps"
 	"slices"
@@ -34,6 +33,10 @@ func (c *config) makeLoader() error {
 	imports := make([]javascript.ArrayElement, 0, len(c.filesDone))
 
 	for url, file := range sortedMap(c.filesDone) {
+		if file.chunk != nil {
+			continue
+		}
+
 		imports = append(imports, wrapURLNameSpace(url, file.prefix))
 	}
 
@@ -46,26 +49,43 @@ func (c *config) processFiles() ([]javascript.LexicalBinding, error) {
 	obs := make([]javascript.LexicalBinding, 0, len(c.filesDone))
 
 	for _, file := range sortedMap(c.filesDone) {
-		if !file.requireNamespace && c.bare && (!c.parseDynamic || !c.dynamicRequirement) {
+		if file.chunk != nil || !file.requireNamespace && c.bare && (!c.parseDynamic || !c.dynamicRequirement) {
 			continue
 		}
 
-		fields := make([]javascript.PropertyDefinition, 0, len(file.exports))
+		ns, _, err := c.namespace(file)
+		if err != nil {
+			return nil, err
+		}
 
-		for binding := range sortedMap(file.exports) {
-			b := file.resolveExport(binding)
+		obs = append(obs, ns)
+	}
 
-			if b == nil {
-				return nil, fmt.Errorf("error resolving export %s (%s): %w", binding, file.url, ErrInvalidExport)
-			}
+	return obs, nil
+}
+
+func (c *config) namespace(file *dependency) (javascript.LexicalBinding, []string, error) {
+	if file.cjs {
+		return file.namespaceCommonJS()
+	}
+
+	fields := make([]javascript.PropertyDefinition, 0, len(file.exports))
+	refs := make([]string, 0, len(file.exports))
 
-			fields = append(fields, makeGetter(binding, b.Token))
+	for binding := range sortedMap(file.exports) {
+		b := file.resolveExport(binding)
+
+		if b == nil {
+			return javascript.LexicalBinding{}, nil, file.error("", binding, nil, ErrInvalidExport)
+		} else if !c.isReachable(file, b) {
+			continue
 		}
 
-		obs = append(obs, wrapNameSpaceFields(file.prefix, fields))
+		fields = append(fields, makeGetter(binding, b.Token))
+		refs = append(refs, b.Data)
 	}
 
-	return obs, nil
+	return wrapNameSpaceFields(file.prefix, fields), refs, nil
 }
 
 func sortedMap[K cmp.Ordered, V any](m map[K]V) iter.Seq2[K, V] {
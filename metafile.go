@@ -0,0 +1,134 @@
+package jspacker
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Metafile describes the modules packaged by a call to Package. It can be
+// encoded as JSON, producing a document of the following form:
+//
+//	{
+//		"modules": [
+//			{
+//				"url": "/main.js",
+//				"prefix": "a_",
+//				"bytes": 1024,
+//				"gzipBytes": 512,
+//				"imports": [
+//					{"url": "/lib.js"},
+//					{"url": "/lazy.js", "dynamic": true}
+//				],
+//				"exports": ["default", "fn"],
+//				"chunk": "/chunks/chunk-b.js"
+//			}
+//		]
+//	}
+//
+// Modules are sorted by URL.
+type Metafile struct {
+	Modules []MetaModule `json:"modules"`
+}
+
+// MetaModule describes a single packaged module.
+type MetaModule struct {
+	// URL is the resolved URL of the module.
+	URL string `json:"url"`
+
+	// Prefix is the prefix added to the names of the bindings of the module.
+	Prefix string `json:"prefix"`
+
+	// Bytes is the size of the printed statements that the module contributes
+	// to the output, or to its chunk.
+	Bytes int `json:"bytes"`
+
+	// GzipBytes is the size of the printed statements of the module when
+	// compressed, on their own, with gzip. As compression depends on the
+	// surrounding data, this is only an estimate of the contribution of the
+	// module to compressed output.
+	GzipBytes int `json:"gzipBytes"`
+
+	// Imports lists the modules imported by the module, with static imports
+	// in import order, followed by dynamic imports sorted by URL.
+	Imports []MetaImport `json:"imports"`
+
+	// Exports lists the names exported by the module, sorted.
+	Exports []string `json:"exports"`
+
+	// Chunk is the URL of the chunk containing the module, when split by the
+	// SplitDynamic Option.
+	Chunk string `json:"chunk,omitempty"`
+}
+
+// MetaImport describes an import of a module.
+type MetaImport struct {
+	URL     string `json:"url"`
+	Dynamic bool   `json:"dynamic,omitempty"`
+}
+
+func (c *config) setMetafile() {
+	c.metafile.Modules = make([]MetaModule, 0, len(c.filesDone))
+
+	for url, file := range sortedMap(c.filesDone) {
+		m := MetaModule{
+			URL:     url,
+			Prefix:  file.prefix,
+			Imports: make([]MetaImport, 0, len(file.requireOrder)+len(file.dynamicRequires)),
+			Exports: make([]string, 0, len(file.exports)),
+		}
+
+		var text strings.Builder
+
+		for _, item := range file.items {
+			if item.keep {
+				fmt.Fprintf(&text, "%+s\n", item.ModuleItem)
+			}
+		}
+
+		m.Bytes = text.Len()
+		m.GzipBytes = gzipSize(text.String())
+
+		for _, r := range file.requireOrder {
+			m.Imports = append(m.Imports, MetaImport{URL: r.url})
+		}
+
+		for url := range sortedMap(file.dynamicRequires) {
+			m.Imports = append(m.Imports, MetaImport{URL: url, Dynamic: true})
+		}
+
+		for export := range sortedMap(file.exports) {
+			m.Exports = append(m.Exports, export)
+		}
+
+		if file.chunk != nil {
+			m.Chunk = file.chunk.url
+		}
+
+		c.metafile.Modules = append(c.metafile.Modules, m)
+	}
+}
+
+func gzipSize(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	var c counter
+
+	g, _ := gzip.NewWriterLevel(&c, gzip.BestCompression)
+
+	io.WriteString(g, text)
+	g.Close()
+
+	return int(c)
+}
+
+type counter int
+
+func (c *counter) Write(p []byte) (int, error) {
+	*c += counter(len(p))
+
+	return len(p), nil
+}
@@ -0,0 +1,562 @@
+package jspacker
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/javascript/scope"
+	"vimagination.zapto.org/javascript/walk"
+	"vimagination.zapto.org/parser"
+)
+
+func (c *config) minifyOutput() {
+	m := &javascript.Module{ModuleListItems: c.moduleItems}
+
+	minify(m, c.format == FormatESM)
+
+	c.moduleItems = m.ModuleListItems
+
+	for _, ch := range c.chunks {
+		minify(ch.module, true)
+	}
+}
+
+func minify(m *javascript.Module, isModule bool) {
+	var (
+		pinned = make(map[string]struct{})
+		fold   walk.HandlerFunc
+	)
+
+	fold = func(t javascript.Type) error {
+		walk.Walk(t, fold)
+
+		switch t := t.(type) {
+		case *javascript.AdditiveExpression:
+			foldAdditive(t)
+		case *javascript.MultiplicativeExpression:
+			foldMultiplicative(t)
+		case *javascript.Block:
+			t.StatementList = removeDeadCode(t.StatementList)
+		case *javascript.PropertyDefinition:
+			if t.IsCoverInitializedName && t.PropertyName != nil && t.PropertyName.LiteralPropertyName != nil {
+				pinned[t.PropertyName.LiteralPropertyName.Data] = struct{}{}
+			} else {
+				expandShorthandProperty(t)
+			}
+		case *javascript.BindingProperty:
+			expandShorthandBinding(t)
+		case *javascript.AssignmentProperty:
+			expandShorthandAssignment(t, pinned)
+		}
+
+		return nil
+	}
+
+	walk.Walk(m, fold)
+
+	renameLocals(m, isModule && !hasExports(m), pinned)
+}
+
+func foldAdditive(ae *javascript.AdditiveExpression) {
+	if ae.AdditiveExpression == nil {
+		return
+	}
+
+	left, right := literal(ae.AdditiveExpression), literal(&ae.MultiplicativeExpression)
+	if left == nil || right == nil {
+		return
+	}
+
+	var folded string
+
+	if left.Type == javascript.TokenStringLiteral && right.Type == javascript.TokenStringLiteral {
+		if ae.AdditiveOperator != javascript.AdditiveAdd {
+			return
+		}
+
+		l, errl := javascript.Unquote(left.Data)
+		r, errr := javascript.Unquote(right.Data)
+
+		if errl != nil || errr != nil || strings.Contains(left.Data, `\u`) || strings.Contains(right.Data, `\u`) {
+			return
+		}
+
+		folded = jsonString(l + r)
+	} else if a, b, ok := numbers(left, right); !ok {
+		return
+	} else if ae.AdditiveOperator == javascript.AdditiveAdd {
+		folded = formatNumber(a+b, len(left.Data)+len(right.Data)+1)
+	} else {
+		folded = formatNumber(a-b, len(left.Data)+len(right.Data)+1)
+	}
+
+	if folded != "" {
+		*ae = javascript.WrapConditional(literalExpression(left.Type, folded)).LogicalORExpression.LogicalANDExpression.BitwiseORExpression.BitwiseXORExpression.BitwiseANDExpression.EqualityExpression.RelationalExpression.ShiftExpression.AdditiveExpression
+	}
+}
+
+func foldMultiplicative(me *javascript.MultiplicativeExpression) {
+	if me.MultiplicativeExpression == nil || me.MultiplicativeOperator != javascript.MultiplicativeMultiply {
+		return
+	}
+
+	left, right := literal(me.MultiplicativeExpression), literal(&me.ExponentiationExpression)
+	if left == nil || right == nil {
+		return
+	}
+
+	if a, b, ok := numbers(left, right); ok {
+		if folded := formatNumber(a*b, len(left.Data)+len(right.Data)+1); folded != "" {
+			*me = javascript.WrapConditional(literalExpression(left.Type, folded)).LogicalORExpression.LogicalANDExpression.BitwiseORExpression.BitwiseXORExpression.BitwiseANDExpression.EqualityExpression.RelationalExpression.ShiftExpression.AdditiveExpression.MultiplicativeExpression
+		}
+	}
+}
+
+func literal(w javascript.ConditionalWrappable) *javascript.Token {
+	if pe, ok := javascript.UnwrapConditional(javascript.WrapConditional(w)).(*javascript.PrimaryExpression); ok && pe.Literal != nil {
+		return pe.Literal
+	}
+
+	return nil
+}
+
+func literalExpression(typ parser.TokenType, data string) *javascript.PrimaryExpression {
+	return &javascript.PrimaryExpression{
+		Literal: &javascript.Token{
+			Token: parser.Token{
+				Type: typ,
+				Data: data,
+			},
+		},
+	}
+}
+
+func numbers(a, b *javascript.Token) (float64, float64, bool) {
+	x, okx := number(a)
+	y, oky := number(b)
+
+	return x, y, okx && oky
+}
+
+func number(tk *javascript.Token) (float64, bool) {
+	if tk.Type != javascript.TokenNumericLiteral || len(tk.Data) > 1 && tk.Data[0] == '0' && tk.Data[1] >= '0' && tk.Data[1] <= '9' {
+		return 0, false
+	}
+
+	n, err := strconv.ParseFloat(tk.Data, 64)
+
+	return n, err == nil
+}
+
+func formatNumber(n float64, max int) string {
+	if n < 0 || n == 0 && 1/n < 0 || n > 1e300 {
+		return ""
+	}
+
+	str := strconv.FormatFloat(n, 'g', -1, 64)
+	if len(str) > max {
+		return ""
+	}
+
+	return str
+}
+
+func removeDeadCode(list []javascript.StatementListItem) []javascript.StatementListItem {
+	var (
+		filtered = list[:0]
+		dead     bool
+	)
+
+	for _, sli := range list {
+		if !dead || isHoisted(sli) {
+			if s := sli.Statement; s != nil && s.IfStatement != nil && !dead {
+				if replacement, ok := constantIf(s.IfStatement); !ok {
+					filtered = append(filtered, sli)
+				} else if replacement != nil {
+					filtered = append(filtered, javascript.StatementListItem{Statement: replacement})
+				}
+			} else {
+				filtered = append(filtered, sli)
+			}
+		}
+
+		if s := sli.Statement; s != nil && s.Type != javascript.StatementNormal {
+			dead = true
+		}
+	}
+
+	return filtered
+}
+
+func isHoisted(sli javascript.StatementListItem) bool {
+	return sli.Declaration != nil || sli.Statement != nil && sli.Statement.VariableStatement != nil
+}
+
+func constantIf(is *javascript.IfStatement) (*javascript.Statement, bool) {
+	if len(is.Expression.Expressions) != 1 {
+		return nil, false
+	}
+
+	ae := &is.Expression.Expressions[0]
+	if ae.ConditionalExpression == nil || ae.AssignmentOperator != javascript.AssignmentNone {
+		return nil, false
+	}
+
+	tk := literal(ae.ConditionalExpression)
+	if tk == nil || tk.Type != javascript.TokenBooleanLiteral {
+		return nil, false
+	}
+
+	keep, drop := &is.Statement, is.ElseStatement
+
+	if tk.Data == "false" {
+		keep, drop = drop, keep
+	}
+
+	if drop != nil && hasVar(drop) || keep != nil && keep.BlockStatement == nil && !isSimpleStatement(keep) {
+		return nil, false
+	}
+
+	return keep, true
+}
+
+func hasVar(s *javascript.Statement) bool {
+	var (
+		found bool
+		find  walk.HandlerFunc
+	)
+
+	find = func(t javascript.Type) error {
+		if _, ok := t.(*javascript.VariableStatement); ok {
+			found = true
+		} else if !found {
+			walk.Walk(t, find)
+		}
+
+		return nil
+	}
+
+	walk.Walk(s, find)
+
+	return found
+}
+
+func isSimpleStatement(s *javascript.Statement) bool {
+	return s.ExpressionStatement != nil || s.Type != javascript.StatementNormal
+}
+
+func expandShorthandProperty(pd *javascript.PropertyDefinition) {
+	if pd.MethodDefinition != nil || pd.AssignmentExpression == nil || pd.AssignmentExpression.ConditionalExpression == nil {
+		return
+	}
+
+	pe, ok := javascript.UnwrapConditional(pd.AssignmentExpression.ConditionalExpression).(*javascript.PrimaryExpression)
+	if !ok || pe.IdentifierReference == nil {
+		return
+	}
+
+	if pd.PropertyName == nil {
+		pd.PropertyName = &javascript.PropertyName{LiteralPropertyName: jToken(pe.IdentifierReference.Data)}
+	} else if pd.PropertyName.LiteralPropertyName == pe.IdentifierReference {
+		pd.PropertyName.LiteralPropertyName = jToken(pe.IdentifierReference.Data)
+	}
+}
+
+func expandShorthandBinding(bp *javascript.BindingProperty) {
+	if bp.BindingElement.SingleNameBinding == nil || bp.PropertyName.ComputedPropertyName != nil {
+		return
+	}
+
+	if bp.PropertyName.LiteralPropertyName == nil || bp.PropertyName.LiteralPropertyName == bp.BindingElement.SingleNameBinding {
+		bp.PropertyName.LiteralPropertyName = jToken(bp.BindingElement.SingleNameBinding.Data)
+	}
+}
+
+func expandShorthandAssignment(ap *javascript.AssignmentProperty, pinned map[string]struct{}) {
+	key := ap.PropertyName.LiteralPropertyName
+	if key == nil || ap.PropertyName.ComputedPropertyName != nil {
+		return
+	} else if ap.DestructuringAssignmentTarget == nil {
+		pinned[key.Data] = struct{}{}
+
+		return
+	}
+
+	lhs := ap.DestructuringAssignmentTarget.LeftHandSideExpression
+	if lhs != nil && lhs.NewExpression != nil && lhs.NewExpression.MemberExpression.PrimaryExpression != nil && lhs.NewExpression.MemberExpression.PrimaryExpression.IdentifierReference == key {
+		ap.PropertyName.LiteralPropertyName = jToken(key.Data)
+	}
+}
+
+func hasExports(m *javascript.Module) bool {
+	for _, mi := range m.ModuleListItems {
+		if mi.ExportDeclaration != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasWith(m *javascript.Module) bool {
+	var (
+		found bool
+		find  walk.HandlerFunc
+	)
+
+	find = func(t javascript.Type) error {
+		if _, ok := t.(*javascript.WithStatement); ok {
+			found = true
+		} else if !found {
+			walk.Walk(t, find)
+		}
+
+		return nil
+	}
+
+	walk.Walk(m, find)
+
+	return found
+}
+
+func isUnbound(bindings []scope.Binding) bool {
+	return len(bindings) > 0 && (bindings[0].BindingType == scope.BindingRef || bindings[0].BindingType == scope.BindingBare)
+}
+
+func renameLocals(m *javascript.Module, renameTop bool, pinned map[string]struct{}) {
+	s, err := scope.ModuleScope(m, nil)
+	if err != nil || isUnbound(s.Bindings["eval"]) || hasWith(m) {
+		return
+	}
+
+	taken := maps.Clone(pinned)
+
+	for name, bindings := range s.Bindings {
+		if !renameTop || isUnbound(bindings) || bindings[0].BindingType == scope.BindingImport {
+			taken[name] = struct{}{}
+		}
+	}
+
+	if renameTop {
+		taken = renameScope(s, taken, pinned)
+	}
+
+	for _, cs := range s.Scopes {
+		renameChildren(cs, taken, pinned)
+	}
+}
+
+func renameChildren(s *scope.Scope, taken, pinned map[string]struct{}) {
+	taken = renameScope(s, taken, pinned)
+
+	for _, cs := range s.Scopes {
+		renameChildren(cs, taken, pinned)
+	}
+}
+
+// renameScope gives short names to the bindings declared in the given scope,
+// avoiding any name in taken, which holds the names visible from the scope.
+//
+// Only pinned names, imports, and arguments keep their names; any other
+// binding is renamed, even when its name is free, so that it cannot capture a
+// renamed binding from an outer scope.
+func renameScope(s *scope.Scope, taken, pinned map[string]struct{}) map[string]struct{} {
+	var names []string
+
+	own := make(map[string]struct{}, len(taken)+len(s.Bindings))
+
+	for name := range taken {
+		own[name] = struct{}{}
+	}
+
+	for name, bindings := range s.Bindings {
+		if len(bindings) == 0 || isUnbound(bindings) {
+			continue
+		} else if _, ok := pinned[name]; ok || bindings[0].BindingType == scope.BindingImport || name == "arguments" {
+			own[name] = struct{}{}
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		if c := cmp.Compare(len(s.Bindings[b]), len(s.Bindings[a])); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	next := 0
+
+	for _, name := range names {
+		short := shortName(next)
+
+		for next++; isTaken(own, short); next++ {
+			short = shortName(next)
+		}
+
+		for _, b := range s.Bindings[name] {
+			b.Data = short
+		}
+
+		own[short] = struct{}{}
+	}
+
+	return own
+}
+
+func isTaken(taken map[string]struct{}, name string) bool {
+	if _, ok := taken[name]; ok {
+		return true
+	}
+
+	_, ok := reservedWords[name]
+
+	return ok
+}
+
+const (
+	nameStart = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_$"
+	namePart  = nameStart + "0123456789"
+)
+
+func shortName(n int) string {
+	name := []byte{nameStart[n%len(nameStart)]}
+
+	for n /= len(nameStart); n > 0; n /= len(namePart) {
+		n--
+		name = append(name, namePart[n%len(namePart)])
+	}
+
+	return string(name)
+}
+
+// PrintMinified writes the given module to the Writer with all unnecessary
+// whitespace, comments, and semicolons removed.
+//
+// It is intended to be used on the output of Package when the Minify Option
+// has been set.
+func PrintMinified(w io.Writer, m *javascript.Module) error {
+	var (
+		tk      = parser.NewStringTokeniser(fmt.Sprintf("%s", m))
+		t       = javascript.SetTokeniser(&tk)
+		sb      strings.Builder
+		last    parser.Token
+		before  string
+		semi    bool
+		parens  []bool
+		control bool
+	)
+
+	for {
+		out, err := t.GetToken()
+		if err != nil {
+			return fmt.Errorf("error tokenising output: %w", err)
+		} else if out.Type == parser.TokenDone {
+			break
+		} else if !isSignificant(out.Type) {
+			continue
+		}
+
+		if semi {
+			semi = false
+
+			if out.Data != "}" || isEmptyStatement(last.Data, control) {
+				sb.WriteByte(';')
+
+				before = last.Data
+				last = parser.Token{Type: javascript.TokenPunctuator, Data: ";"}
+			}
+		}
+
+		switch out.Data {
+		case ";":
+			semi = true
+
+			continue
+		case "(":
+			parens = append(parens, isControl(before, last.Data))
+		case ")":
+			if len(parens) > 0 {
+				control = parens[len(parens)-1]
+				parens = parens[:len(parens)-1]
+			}
+		}
+
+		if needsSpace(last, out.Data) {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteString(out.Data)
+
+		before = last.Data
+		last = out
+	}
+
+	if semi {
+		sb.WriteByte(';')
+	}
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// isControl determines whether a parenthesis following the given tokens opens
+// the head of a statement that may have an empty body.
+func isControl(before, last string) bool {
+	switch last {
+	case "if", "for", "while", "with":
+		return true
+	case "await":
+		return before == "for"
+	}
+
+	return false
+}
+
+// isEmptyStatement determines whether a semicolon following the given token is
+// an empty statement, and so cannot be removed before a closing brace.
+func isEmptyStatement(prev string, control bool) bool {
+	return prev == ")" && control || prev == "else" || prev == ":"
+}
+
+func needsSpace(last parser.Token, next string) bool {
+	prev := last.Data
+
+	if prev == "" || next == "" {
+		return false
+	}
+
+	a, b := prev[len(prev)-1], next[0]
+
+	switch {
+	case isWordByte(a) && (isWordByte(b) || b == '#'):
+		return true
+	case last.Type == javascript.TokenRegularExpressionLiteral && isWordByte(b):
+		return true
+	case a == '+' && b == '+', a == '-' && b == '-', a == '/' && (b == '/' || b == '*'):
+		return true
+	case a == '<' && b == '!', strings.HasSuffix(prev, "--") && b == '>':
+		return true
+	case b == '.' && isNumericStart(prev[0]) && !strings.ContainsAny(prev, ".eExXoObB"):
+		return true
+	}
+
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c == '\\' || c >= 0x80
+}
+
+func isNumericStart(c byte) bool {
+	return c >= '0' && c <= '9'
+}
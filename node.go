@@ -0,0 +1,276 @@
+package jspacker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var defaultConditions = []string{"browser", "import", "module"}
+
+type packageJSON struct {
+	Exports json.RawMessage `json:"exports"`
+	Module  string          `json:"module"`
+	Main    string          `json:"main"`
+}
+
+type nodeResolver struct {
+	fsys       fs.FS
+	conditions []string
+
+	mu       sync.Mutex
+	packages map[string]*packageJSON
+	errors   map[string]error
+}
+
+// NodeModules is an Option that resolves bare import specifiers, such as
+// 'lit' or '@scope/pkg/sub', by searching node_modules directories in the
+// given fs.FS, starting from the directory of the importing module.
+//
+// See NodeResolver for more details.
+func NodeModules(fsys fs.FS, conditions ...string) Option {
+	return ResolveURLWithError(NodeResolver(fsys, conditions...))
+}
+
+// NodeResolver returns a func, suitable for use with ResolveURLWithError, that resolves
+// bare import specifiers by searching node_modules directories in the given
+// fs.FS, starting from the directory of the importing module and moving up
+// towards the root.
+//
+// The 'exports' field of a package's package.json is used when it exists,
+// including subpath patterns, with the first matching of the given conditions,
+// or 'default', being chosen. If no conditions are given, the 'browser',
+// 'import', and 'module' conditions are used.
+//
+// Without an 'exports' field, the 'module' or 'main' fields, or 'index.js',
+// are used for the package root, and subpaths are used as-is.
+//
+// A subpath that is not exported by a package with an 'exports' field, or
+// whose target is null, returns ErrNotExported, and a package.json that
+// cannot be parsed returns ErrInvalidPackage.
+//
+// Any other specifiers, and any bare specifiers whose package cannot be found,
+// are resolved with RelTo.
+func NodeResolver(fsys fs.FS, conditions ...string) func(from, to string) (string, error) {
+	if len(conditions) == 0 {
+		conditions = defaultConditions
+	}
+
+	n := &nodeResolver{
+		fsys:       fsys,
+		conditions: conditions,
+		packages:   make(map[string]*packageJSON),
+		errors:     make(map[string]error),
+	}
+
+	return func(from, to string) (string, error) {
+		if resolved, ok, err := n.resolve(from, to); err != nil {
+			return "", err
+		} else if ok {
+			return resolved, nil
+		}
+
+		return RelTo(from, to), nil
+	}
+}
+
+func isBareSpecifier(specifier string) bool {
+	if specifier == "" || specifier[0] == '/' || specifier == "." || specifier == ".." || strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") {
+		return false
+	}
+
+	if colon := strings.IndexByte(specifier, ':'); colon >= 0 && !strings.Contains(specifier[:colon], "/") {
+		return false
+	}
+
+	return true
+}
+
+func splitPackageName(specifier string) (string, string) {
+	parts := strings.SplitN(specifier, "/", 3)
+	name := parts[0]
+
+	if strings.HasPrefix(name, "@") && len(parts) > 1 {
+		name += "/" + parts[1]
+	}
+
+	return name, "." + strings.TrimPrefix(specifier, name)
+}
+
+func (n *nodeResolver) resolve(from, to string) (string, bool, error) {
+	if !isBareSpecifier(to) {
+		return "", false, nil
+	}
+
+	name, subpath := splitPackageName(to)
+
+	for dir := path.Dir(path.Join("/", from)); ; dir = path.Dir(dir) {
+		pkgDir := path.Join(dir, "node_modules", name)
+
+		if fi, err := fs.Stat(n.fsys, fsName(pkgDir)); err == nil && fi.IsDir() {
+			resolved, err := n.resolvePackage(pkgDir, subpath)
+			if err != nil {
+				return "", false, fmt.Errorf("%w: %s", err, to)
+			}
+
+			return resolved, true, nil
+		}
+
+		if dir == "/" {
+			return "", false, nil
+		}
+	}
+}
+
+func fsName(url string) string {
+	if name := strings.TrimPrefix(path.Clean("/"+url), "/"); name != "" {
+		return name
+	}
+
+	return "."
+}
+
+func (n *nodeResolver) packageJSON(pkgDir string) (*packageJSON, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if pj, ok := n.packages[pkgDir]; ok {
+		return pj, n.errors[pkgDir]
+	}
+
+	pj := new(packageJSON)
+	name := path.Join(pkgDir, "package.json")
+
+	data, err := fs.ReadFile(n.fsys, fsName(name))
+	if err == nil {
+		if err = json.Unmarshal(data, pj); err != nil {
+			err = fmt.Errorf("%w: %s: %w", ErrInvalidPackage, name, err)
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+
+	n.packages[pkgDir] = pj
+	n.errors[pkgDir] = err
+
+	return pj, err
+}
+
+func (n *nodeResolver) resolvePackage(pkgDir, subpath string) (string, error) {
+	pj, err := n.packageJSON(pkgDir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pj.Exports) > 0 && !bytes.Equal(pj.Exports, []byte("null")) {
+		if resolved, ok := n.resolveExports(pkgDir, subpath, pj.Exports); ok {
+			return resolved, nil
+		}
+
+		return "", ErrNotExported
+	}
+
+	if subpath != "." {
+		return path.Join(pkgDir, subpath), nil
+	}
+
+	for _, entry := range [...]string{pj.Module, pj.Main} {
+		if entry != "" {
+			return path.Join(pkgDir, entry), nil
+		}
+	}
+
+	return path.Join(pkgDir, "index.js"), nil
+}
+
+func (n *nodeResolver) resolveExports(pkgDir, subpath string, exports json.RawMessage) (string, bool) {
+	obj, isObject := jsonObject(exports)
+
+	if !isObject || len(obj) > 0 && !strings.HasPrefix(obj[0].key, ".") {
+		if subpath != "." {
+			return "", false
+		}
+
+		return n.resolveTarget(pkgDir, exports, "")
+	}
+
+	var (
+		best      *jsonEntry
+		bestMatch string
+	)
+
+	for _, entry := range obj {
+		if entry.key == subpath {
+			return n.resolveTarget(pkgDir, entry.value, "")
+		}
+
+		prefix, suffix, ok := strings.Cut(entry.key, "*")
+		if !ok || strings.Contains(suffix, "*") || !strings.HasPrefix(subpath, prefix) || !strings.HasSuffix(subpath, suffix) || len(subpath) < len(entry.key) {
+			continue
+		}
+
+		if best == nil || patternKeyCompare(entry.key, best.key) < 0 {
+			best = &entry
+			bestMatch = subpath[len(prefix) : len(subpath)-len(suffix)]
+		}
+	}
+
+	if best != nil {
+		return n.resolveTarget(pkgDir, best.value, bestMatch)
+	}
+
+	return "", false
+}
+
+func patternKeyCompare(a, b string) int {
+	aBase := strings.IndexByte(a, '*') + 1
+	bBase := strings.IndexByte(b, '*') + 1
+
+	if aBase != bBase {
+		return bBase - aBase
+	}
+
+	return len(b) - len(a)
+}
+
+func (n *nodeResolver) resolveTarget(pkgDir string, target json.RawMessage, match string) (string, bool) {
+	var str string
+
+	if err := json.Unmarshal(target, &str); err == nil {
+		if !strings.HasPrefix(str, "./") {
+			return "", false
+		}
+
+		return path.Join(pkgDir, strings.ReplaceAll(str, "*", match)), true
+	}
+
+	var arr []json.RawMessage
+
+	if err := json.Unmarshal(target, &arr); err == nil {
+		for _, t := range arr {
+			if resolved, ok := n.resolveTarget(pkgDir, t, match); ok {
+				return resolved, true
+			}
+		}
+
+		return "", false
+	}
+
+	if obj, ok := jsonObject(target); ok {
+		for _, entry := range obj {
+			if entry.key == "default" || slices.Contains(n.conditions, entry.key) {
+				if resolved, ok := n.resolveTarget(pkgDir, entry.value, match); ok {
+					return resolved, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
@@ -1,11 +1,15 @@
 package jspacker
 
 import (
+	"cmp"
 	"fmt"
+	"io"
+	"io/fs"
 	"iter"
+	"maps"
 	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 	"text/template"
 
@@ -31,6 +35,18 @@ func NoExports(c *config) {
 
 // Loader sets the func that will take URLs and produce a parsed module.
 func Loader(l func(string) (*javascript.Module, error)) Option {
+	return func(c *config) {
+		c.loader = func(url, _ string) (*javascript.Module, error) {
+			return l(url)
+		}
+	}
+}
+
+// TypedLoader sets the func that will take URLs, along with the value of the
+// 'type' import attribute, and produce a parsed module.
+//
+// The type will be empty for imports without a 'type' attribute.
+func TypedLoader(l func(url, typ string) (*javascript.Module, error)) Option {
 	return func(c *config) {
 		c.loader = l
 	}
@@ -46,19 +62,168 @@ func PrimaryExports(c *config) {
 	c.primary = true
 }
 
+// Format sets the format of the output produced by Package, which defaults to
+// FormatESM.
+//
+// FormatIIFE wraps the output in an immediately invoked function, so that it
+// can be used as a classic script without leaking globals; FormatCJS produces
+// a CommonJS module; and FormatUMD produces a module that can be loaded with
+// AMD, CommonJS, or as a classic script.
+//
+// When PrimaryExports is set, the exports of the first passed file are
+// returned from the IIFE, assigned to module.exports for CJS, or returned from
+// the UMD factory. The given name, if not empty, is used as the global that
+// the exports will be assigned to for IIFE and UMD output; setting a name for
+// IIFE output without PrimaryExports is an error.
+func Format(f OutputFormat, name string) Option {
+	return func(c *config) {
+		c.format = f
+		c.globalName = name
+	}
+}
+
+// TreeShake removes top-level declarations that cannot be reached from the
+// passed files, keeping any statements that may have side effects.
+//
+// Namespace getters for removed exports are also dropped.
+func TreeShake(c *config) {
+	c.treeShake = true
+}
+
+// SourceMap records the origin of each packaged token in the given
+// SourceMapper, allowing a source map to be generated for the output, and for
+// any chunks created by SplitDynamic.
+func SourceMap(s *SourceMapper) Option {
+	return func(c *config) {
+		c.sourceMap = s
+	}
+}
+
+// Metadata fills the given Metafile with a description of each packaged
+// module, including its imports, exports, and contribution to the output size.
+func Metadata(m *Metafile) Option {
+	return func(c *config) {
+		c.metafile = m
+	}
+}
+
+// SplitDynamic enables code splitting, implying ParseDynamic.
+//
+// Modules that are only reachable through dynamic imports are removed from the
+// main output and packaged into separate chunk modules, with modules shared
+// between multiple dynamic imports being placed into common chunks. Each chunk
+// is passed to the given func along with the URL it will be loaded from,
+// which will be in the given directory, and named after the URL of each
+// dynamically imported module it serves.
+//
+// Dynamic imports of split modules are rewritten to load the relevant chunk.
+//
+// As chunks are ES modules, SplitDynamic can only be used with FormatESM.
+func SplitDynamic(dir string, fn func(url string, chunk *javascript.Module)) Option {
+	return func(c *config) {
+		c.parseDynamic = true
+		c.splitDir = dir
+		c.splitFn = fn
+	}
+}
+
+// ReportCycles sets a func that will be called with the URLs that make up each
+// circular import chain found by Package. The first URL in the chain is
+// repeated at the end.
+func ReportCycles(fn func(urls []string)) Option {
+	return func(c *config) {
+		c.cycleFn = fn
+	}
+}
+
+// StrictCycles causes Package to return an ErrCircularDependency error when a
+// module in an import cycle uses, at the top level, an imported binding that
+// will not yet have been evaluated.
+func StrictCycles(c *config) {
+	c.strictCycles = true
+}
+
+// Workers sets the maximum number of modules that can be loaded at once. When
+// set to more than one, the imports of each loaded module are fetched
+// concurrently, ahead of their processing.
+//
+// Modules are still processed in the same order, so the output is unaffected.
+//
+// The Loader and any ResolveURL func must be safe for concurrent use.
+func Workers(n int) Option {
+	return func(c *config) {
+		c.workers = n
+	}
+}
+
+// Warnings sets a func that will be called with each Warning found while
+// processing modules, such as unused imports and uses of direct eval.
+func Warnings(fn func(Warning)) Option {
+	return func(c *config) {
+		c.warnFn = fn
+	}
+}
+
+// Minify shrinks the output of Package, and any split chunks, by folding
+// simple constant expressions, removing unreachable code, and shortening the
+// names of local bindings. Top-level bindings are only renamed in ESM output
+// that has no exports.
+//
+// The resulting modules should be written with PrintMinified, which also
+// removes unnecessary whitespace, comments, and semicolons.
+//
+// Minify cannot be combined with SourceMap.
+func Minify(c *config) {
+	c.minify = true
+}
+
+// MaxErrors sets the number of errors after which Package will stop
+// processing modules. A value of zero or less, the default, removes the limit.
+//
+// Missing modules, modules that fail to parse or contain duplicate
+// declarations, and imports of missing exports are recorded without stopping
+// processing, and are returned together once all modules have been loaded.
+func MaxErrors(n int) Option {
+	return func(c *config) {
+		c.maxErrors = n
+	}
+}
+
+// UseCache sets a Cache that will be used to store loaded modules, and to
+// retrieve those modules in later calls to Package.
+func UseCache(cache *Cache) Option {
+	return func(c *config) {
+		c.cache = cache
+	}
+}
+
 // ResolveURL allows for custom import URL resolution.
 //
 // The function inputs are the URL for the current module and the import URL
 // that needs resolving.
 func ResolveURL(fn func(from, to string) string) Option {
+	return func(c *config) {
+		c.resolveURL = func(from, to string) (string, error) {
+			return fn(from, to), nil
+		}
+	}
+}
+
+// ResolveURLWithError allows for custom import URL resolution that can fail,
+// such as with an import that is blocked by an import map.
+//
+// Any error returned is reported against the importing module.
+func ResolveURLWithError(fn func(from, to string) (string, error)) Option {
 	return func(c *config) {
 		c.resolveURL = fn
 	}
 }
 
 type loadOpts struct {
-	disableTS bool
-	jsx       *template.Template
+	disableTS   bool
+	jsx         *template.Template
+	sourceNames func(string, string)
+	types       map[string]string
 }
 
 // LoadOpt represents an option for the OSLoad Option.
@@ -81,6 +246,35 @@ func EnableJSX(jsx *template.Template) LoadOpt {
 	}
 }
 
+// SourceNames sets a func that will be called, for each module loaded by the
+// OSLoad Option, with the requested URL and the URL of the file that was
+// actually loaded, which may differ when a Typescript or JSX file is used.
+//
+// The SetSource method of SourceMapper can be used with this option.
+func SourceNames(fn func(url, source string)) LoadOpt {
+	return func(l *loadOpts) {
+		l.sourceNames = fn
+	}
+}
+
+// ExtensionTypes sets the import type used to load files with the given
+// extensions, when the import does not specify a 'type' attribute.
+//
+// The keys of the map are file extensions, including the leading '.', and the
+// values are one of the following import types:
+//
+//	json:    The default export is the parsed JSON value.
+//	text:    The default export is the file contents, as a string.
+//	bytes:   The default export is a Uint8Array of the file contents.
+//	dataurl: The default export is a data: URL of the file contents.
+//
+// By default, '.json' files are loaded as JSON.
+func ExtensionTypes(types map[string]string) LoadOpt {
+	return func(l *loadOpts) {
+		maps.Copy(l.types, types)
+	}
+}
+
 const (
 	jsSuffix  = ".js"
 	tsSuffix  = ".ts"
@@ -88,41 +282,60 @@ const (
 	tsxSuffix = ".tsx"
 )
 
-func loadFns(base, urlPath string, allowTS, allowJSX bool, ts, jsx *bool) iter.Seq[func() (*os.File, error)] {
-	return func(yield func(func() (*os.File, error)) bool) {
-		for _, fn := range [...]func() (*os.File, error){
-			func() (*os.File, error) { // Assume that any TSX file will be more up-to-date by default
+type namedFile struct {
+	fs.File
+	name string
+}
+
+func openFS(fsys fs.FS, urlPath string) (*namedFile, error) {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &namedFile{File: f, name: name}, nil
+}
+
+func loadFns(fsys fs.FS, urlPath string, allowTS, allowJSX bool, ts, jsx *bool) iter.Seq[func() (*namedFile, error)] {
+	return func(yield func(func() (*namedFile, error)) bool) {
+		for _, fn := range [...]func() (*namedFile, error){
+			func() (*namedFile, error) { // Assume that any TSX file will be more up-to-date by default
 				if allowTS && allowJSX && strings.HasSuffix(urlPath, jsSuffix) {
 					*ts = true
 					*jsx = true
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath[:len(urlPath)-3]+tsxSuffix)))
+					return openFS(fsys, urlPath[:len(urlPath)-3]+tsxSuffix)
 				}
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Assume that any JSX file will be more up-to-date by default
+			func() (*namedFile, error) { // Assume that any JSX file will be more up-to-date by default
 				if allowJSX && strings.HasSuffix(urlPath, jsSuffix) {
 					*ts = false
 					*jsx = true
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath[:len(urlPath)-3]+jsxSuffix)))
+					return openFS(fsys, urlPath[:len(urlPath)-3]+jsxSuffix)
 				}
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Assume that any TS file will be more up-to-date by default
+			func() (*namedFile, error) { // Assume that any TS file will be more up-to-date by default
 				if allowTS && strings.HasSuffix(urlPath, jsSuffix) {
 					*ts = true
 					*jsx = false
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath[:len(urlPath)-3]+tsSuffix)))
+					return openFS(fsys, urlPath[:len(urlPath)-3]+tsSuffix)
 				}
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Normal
-				f, err := os.Open(filepath.Join(base, filepath.FromSlash(urlPath)))
+			func() (*namedFile, error) { // Normal
+				f, err := openFS(fsys, urlPath)
 				if err == nil {
 					*ts = allowTS && (strings.HasSuffix(urlPath, tsSuffix) || allowJSX && strings.HasSuffix(urlPath, jsxSuffix))
 					*jsx = allowJSX && (strings.HasSuffix(urlPath, jsxSuffix) || allowTS && strings.HasSuffix(urlPath, tsxSuffix))
@@ -130,9 +343,9 @@ func loadFns(base, urlPath string, allowTS, allowJSX bool, ts, jsx *bool) iter.S
 
 				return f, err
 			},
-			func() (*os.File, error) { // As URL
+			func() (*namedFile, error) { // As URL
 				if u, err := url.Parse(urlPath); err == nil && u.Path != urlPath {
-					f, err := os.Open(filepath.Join(base, filepath.FromSlash(u.Path)))
+					f, err := openFS(fsys, u.Path)
 					if err == nil {
 						*ts = allowTS && (strings.HasSuffix(urlPath, tsSuffix) || allowJSX && strings.HasSuffix(urlPath, jsxSuffix))
 						*jsx = allowJSX && (strings.HasSuffix(urlPath, jsxSuffix) || allowTS && strings.HasSuffix(urlPath, tsxSuffix))
@@ -143,42 +356,42 @@ func loadFns(base, urlPath string, allowTS, allowJSX bool, ts, jsx *bool) iter.S
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Add TSX extension
+			func() (*namedFile, error) { // Add TSX extension
 				if allowTS && allowJSX && !strings.HasSuffix(urlPath, tsSuffix) {
 					*ts = true
 					*jsx = true
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath+tsxSuffix)))
+					return openFS(fsys, urlPath+tsxSuffix)
 				}
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Add JSX extension
+			func() (*namedFile, error) { // Add JSX extension
 				if allowJSX && !strings.HasSuffix(urlPath, tsSuffix) {
 					*ts = false
 					*jsx = true
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath+jsxSuffix)))
+					return openFS(fsys, urlPath+jsxSuffix)
 				}
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Add TS extension
+			func() (*namedFile, error) { // Add TS extension
 				if allowTS && !strings.HasSuffix(urlPath, tsSuffix) {
 					*ts = true
 					*jsx = false
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath+tsSuffix)))
+					return openFS(fsys, urlPath+tsSuffix)
 				}
 
 				return nil, nil
 			},
-			func() (*os.File, error) { // Add JS extension
+			func() (*namedFile, error) { // Add JS extension
 				if !strings.HasSuffix(urlPath, jsSuffix) {
 					*ts = false
 					*jsx = false
 
-					return os.Open(filepath.Join(base, filepath.FromSlash(urlPath+jsSuffix)))
+					return openFS(fsys, urlPath+jsSuffix)
 				}
 
 				return nil, nil
@@ -199,23 +412,55 @@ func loadFns(base, urlPath string, allowTS, allowJSX bool, ts, jsx *bool) iter.S
 //
 // JSX support can be added by providing the EnableJSX support with a valid
 // template.
+//
+// Files with a '.json' extension are loaded as JSON modules. Other file types
+// can be loaded as assets by using the ExtensionTypes option.
 func OSLoad(base string, opts ...LoadOpt) func(string) (*javascript.Module, error) {
-	var l loadOpts
+	return FSLoad(os.DirFS(cmp.Or(base, ".")), opts...)
+}
+
+// FSLoad is a loader that reads modules from the given fs.FS, using the same
+// rules for finding Typescript and JSX files as OSLoad.
+func FSLoad(fsys fs.FS, opts ...LoadOpt) func(string) (*javascript.Module, error) {
+	loader := FSTypedLoad(fsys, opts...)
+
+	return func(urlPath string) (*javascript.Module, error) {
+		return loader(urlPath, "")
+	}
+}
+
+// OSTypedLoad is like OSLoad, but for use with the TypedLoader Option.
+//
+// Imports with a 'type' attribute are loaded as that type, regardless of
+// extension; see ExtensionTypes for the supported types.
+func OSTypedLoad(base string, opts ...LoadOpt) func(string, string) (*javascript.Module, error) {
+	return FSTypedLoad(os.DirFS(cmp.Or(base, ".")), opts...)
+}
+
+// FSTypedLoad is like FSLoad, but for use with the TypedLoader Option.
+func FSTypedLoad(fsys fs.FS, opts ...LoadOpt) func(string, string) (*javascript.Module, error) {
+	l := loadOpts{types: map[string]string{".json": "json"}}
 
 	for _, opt := range opts {
 		opt(&l)
 	}
 
-	return func(urlPath string) (*javascript.Module, error) {
+	return func(urlPath, typ string) (*javascript.Module, error) {
+		if typ == "" {
+			typ = l.types[path.Ext(urlPath)]
+		}
+
+		if _, ok := assetTypes[typ]; typ != "" && !ok {
+			return nil, fmt.Errorf("%w: %s (%s)", ErrUnsupportedType, typ, urlPath)
+		}
+
 		var (
-			f   *os.File
-			err error
+			f           *namedFile
+			err         error
+			isTS, isJSX bool
 		)
-		isTSX := strings.HasSuffix(base, tsxSuffix)
-		isTS := isTSX || strings.HasSuffix(base, tsSuffix)
-		isJSX := isTSX || strings.HasSuffix(base, jsxSuffix)
 
-		for loader := range loadFns(base, urlPath, !l.disableTS, l.jsx != nil, &isTS, &isJSX) {
+		for loader := range loadFns(fsys, urlPath, !l.disableTS && typ == "", l.jsx != nil && typ == "", &isTS, &isJSX) {
 			fb, errr := loader()
 			if fb != nil {
 				f = fb
@@ -232,6 +477,24 @@ func OSLoad(base string, opts ...LoadOpt) func(string) (*javascript.Module, erro
 
 		defer f.Close()
 
+		if l.sourceNames != nil {
+			l.sourceNames(urlPath, "/"+f.name)
+		}
+
+		if typ != "" {
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return nil, fmt.Errorf("error reading file (%s): %w", urlPath, err)
+			}
+
+			m, err := assetModule(typ, f.name, data)
+			if err != nil {
+				return nil, fmt.Errorf("error loading file (%s) as %s: %w", urlPath, typ, err)
+			}
+
+			return m, nil
+		}
+
 		rt := parser.NewReaderTokeniser(f)
 
 		var tks javascript.Tokeniser = &rt
@@ -1,6 +1,7 @@
 package jspacker
 
 import (
+	"errors"
 	"strings"
 
 	"vimagination.zapto.org/javascript"
@@ -37,7 +38,7 @@ func (i importBindingMap) Handle(t javascript.Type) error {
 // exports from package.
 func Plugin(m *javascript.Module, url string) (*javascript.Module, error) {
 	if !strings.HasPrefix(url, "/") {
-		return nil, ErrInvalidURL
+		return nil, &Error{Importer: url, Err: ErrInvalidURL}
 	}
 
 	p := plugin{
@@ -48,16 +49,22 @@ func Plugin(m *javascript.Module, url string) (*javascript.Module, error) {
 		},
 		d: dependency{
 			config: &config{
-				resolveURL: RelTo,
+				resolveURL: relTo,
 			},
 			url:    url,
 			prefix: "_",
 		},
 	}
 
+	var dupeErr scope.ErrDuplicateDeclaration
+
 	scope, err := scope.ModuleScope(m, nil)
 	if err != nil {
-		return nil, err
+		if errors.As(err, &dupeErr) {
+			return nil, p.d.error("", "", dupeErr.Duplicate, err)
+		}
+
+		return nil, p.d.error("", "", nil, err)
 	}
 
 	p.process(m, scope)
@@ -83,7 +90,7 @@ func (p *plugin) process(m *javascript.Module, scope *scope.Scope) {
 
 func (p *plugin) processImport(id *javascript.ImportDeclaration, scope *scope.Scope) {
 	durl, _ := javascript.Unquote(id.ModuleSpecifier.Data)
-	iurl := p.d.RelTo(durl)
+	iurl, _ := p.d.RelTo(durl)
 
 	ib, ok := p.importURLs[iurl]
 	if !ok {
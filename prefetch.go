@@ -0,0 +1,132 @@
+package jspacker
+
+import (
+	"errors"
+	"sync"
+
+	"vimagination.zapto.org/javascript"
+)
+
+type prefetcher struct {
+	config  *config
+	sem     chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+	modules map[string]*pendingModule
+}
+
+type pendingModule struct {
+	done   chan struct{}
+	module *javascript.Module
+	err    error
+}
+
+var errPrefetchStopped = errors.New("prefetching stopped")
+
+// stopPrefetch stops any further modules from being fetched ahead of their
+// processing; it is called when Package returns, so that an early return does
+// not leave the whole import tree being loaded in the background.
+func (c *config) stopPrefetch() {
+	if c.prefetcher != nil {
+		close(c.prefetcher.done)
+	}
+}
+
+func (c *config) loadModule(url, typ string) (*javascript.Module, error) {
+	if c.prefetcher == nil {
+		return c.fetchModule(url, typ)
+	}
+
+	p := c.prefetcher.fetch(url, typ)
+
+	<-p.done
+
+	return p.module, p.err
+}
+
+func (c *config) fetchModule(url, typ string) (*javascript.Module, error) {
+	if c.cache != nil {
+		return c.cache.load(url, typ, c.loader)
+	}
+
+	return c.loader(url, typ)
+}
+
+func (p *prefetcher) fetch(url, typ string) *pendingModule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pm, ok := p.modules[url]
+	if !ok {
+		pm = &pendingModule{done: make(chan struct{})}
+		p.modules[url] = pm
+
+		if p.stopped() {
+			pm.err = errPrefetchStopped
+
+			close(pm.done)
+		} else {
+			go p.run(url, typ, pm)
+		}
+	}
+
+	return pm
+}
+
+func (p *prefetcher) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *prefetcher) run(url, typ string, pm *pendingModule) {
+	defer close(pm.done)
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.done:
+		pm.err = errPrefetchStopped
+
+		return
+	}
+
+	if p.stopped() {
+		pm.err = errPrefetchStopped
+	} else {
+		pm.module, pm.err = p.config.fetchModule(url, typ)
+	}
+
+	<-p.sem
+
+	if pm.err != nil || p.stopped() {
+		return
+	}
+
+	for _, li := range pm.module.ModuleListItems {
+		var (
+			fc *javascript.FromClause
+			wc *javascript.WithClause
+		)
+
+		if li.ImportDeclaration != nil {
+			fc = &li.ImportDeclaration.FromClause
+			wc = li.ImportDeclaration.WithClause
+		} else if li.ExportDeclaration != nil {
+			fc = li.ExportDeclaration.FromClause
+			wc = li.ExportDeclaration.WithClause
+		}
+
+		if fc == nil || fc.ModuleSpecifier == nil {
+			continue
+		}
+
+		if durl, err := javascript.Unquote(fc.ModuleSpecifier.Data); err != nil {
+			continue
+		} else if iurl, err := p.config.resolveURL(url, durl); err == nil {
+			p.fetch(iurl, importType(wc))
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package jspacker
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/parser"
+)
+
+// SourceMapper records the origin of each token in a packaged module, and in
+// any split chunks, so that a version 3 source map can be generated for its
+// printed output.
+//
+// The zero value is ready for use.
+type SourceMapper struct {
+	mu      sync.Mutex
+	sources map[string]string
+	outputs map[string][]sourceToken
+}
+
+type sourceToken struct {
+	*javascript.Token
+	url       string
+	line, col int
+}
+
+// SetSource sets the name of the source file that was used to load the given
+// URL. This allows the source map to point at, for example, a Typescript file
+// that was loaded for a '.js' URL.
+//
+// The signature matches that required by the SourceNames LoadOpt.
+func (s *SourceMapper) SetSource(url, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sources == nil {
+		s.sources = make(map[string]string)
+	}
+
+	s.sources[url] = source
+}
+
+func (s *SourceMapper) source(url string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if source, ok := s.sources[url]; ok {
+		return source
+	}
+
+	return url
+}
+
+// record stores the tokens that will be printed for the given module items, in
+// the order they will be printed, along with the source position of those
+// that came from the given items.
+//
+// The main output is recorded with an empty URL, and chunks with their URL.
+func (s *SourceMapper) record(url string, mis []javascript.ModuleItem, items []*moduleItem) {
+	var (
+		origins = make(map[*javascript.Token]*dependency)
+		columns = make(map[*dependency]astralRunes)
+		tokens  []sourceToken
+	)
+
+	for _, item := range items {
+		for _, tk := range printedTokens(reflect.ValueOf(item.ModuleItem), nil) {
+			if item.owns(tk) {
+				origins[tk] = item.dependency
+			}
+		}
+	}
+
+	for _, tk := range printedTokens(reflect.ValueOf(mis), nil) {
+		st := sourceToken{Token: tk}
+
+		if d, ok := origins[tk]; ok {
+			astral, ok := columns[d]
+			if !ok {
+				astral = astralRunesOf(d.tokens)
+				columns[d] = astral
+			}
+
+			st.url = d.url
+			st.line = int(tk.Line)
+			st.col = astral.column(tk)
+		}
+
+		tokens = append(tokens, st)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.outputs == nil {
+		s.outputs = make(map[string][]sourceToken)
+	}
+
+	s.outputs[url] = tokens
+}
+
+// owns determines whether the given token was parsed from the source of the
+// item, rather than being added while packaging.
+func (m *moduleItem) owns(tk *javascript.Token) bool {
+	n := sort.Search(len(m.tokens), func(n int) bool {
+		return m.tokens[n].Pos >= tk.Pos
+	})
+
+	if n == len(m.tokens) {
+		return false
+	}
+
+	src := &m.tokens[n]
+
+	return src == tk || src.Pos == tk.Pos && src.Line == tk.Line && src.LinePos == tk.LinePos && src.Type == tk.Type
+}
+
+var (
+	tokenPtrType    = reflect.TypeFor[*javascript.Token]()
+	tokensType      = reflect.TypeFor[javascript.Tokens]()
+	commentsType    = reflect.TypeFor[javascript.Comments]()
+	templateLitType = reflect.TypeFor[javascript.TemplateLiteral]()
+)
+
+// printedTokens appends, in the order they are printed, the tokens held by
+// the given tree.
+//
+// Consecutive references to the same token, as used by shorthand properties,
+// are only printed once.
+func printedTokens(v reflect.Value, tks []*javascript.Token) []*javascript.Token {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return tks
+		} else if v.Type() == tokenPtrType {
+			return appendPrinted(tks, v.Interface().(*javascript.Token))
+		}
+
+		return printedTokens(v.Elem(), tks)
+	case reflect.Interface:
+		if v.IsNil() {
+			return tks
+		}
+
+		return printedTokens(v.Elem(), tks)
+	case reflect.Slice, reflect.Array:
+		if v.Type() == tokensType || v.Type() == commentsType {
+			return tks
+		}
+
+		for n := range v.Len() {
+			tks = printedTokens(v.Index(n), tks)
+		}
+	case reflect.Struct:
+		if v.Type() == templateLitType {
+			return templateTokens(v, tks)
+		}
+
+		for n := range v.NumField() {
+			if v.Type().Field(n).IsExported() {
+				tks = printedTokens(v.Field(n), tks)
+			}
+		}
+	}
+
+	return tks
+}
+
+// templateTokens appends the tokens of a template literal, whose expressions
+// are printed between its template parts, rather than in field order.
+func templateTokens(v reflect.Value, tks []*javascript.Token) []*javascript.Token {
+	var (
+		expressions = v.FieldByName("Expressions")
+		middles     = v.FieldByName("TemplateMiddleList")
+	)
+
+	tks = printedTokens(v.FieldByName("NoSubstitutionTemplate"), tks)
+	tks = printedTokens(v.FieldByName("TemplateHead"), tks)
+
+	for n := range expressions.Len() {
+		tks = printedTokens(expressions.Index(n), tks)
+
+		if n < middles.Len() {
+			tks = printedTokens(middles.Index(n), tks)
+		}
+	}
+
+	return printedTokens(v.FieldByName("TemplateTail"), tks)
+}
+
+func appendPrinted(tks []*javascript.Token, tk *javascript.Token) []*javascript.Token {
+	if !isSignificant(tk.Type) || len(tks) > 0 && tks[len(tks)-1] == tk {
+		return tks
+	}
+
+	return append(tks, tk)
+}
+
+// astralRunes records the columns, on each line of a source, of the characters
+// that need two UTF-16 code units, allowing source map columns to be
+// calculated from the character columns of tokens.
+type astralRunes map[uint64][]uint64
+
+func astralRunesOf(tks javascript.Tokens) astralRunes {
+	astral := make(astralRunes)
+
+	for _, tk := range tks {
+		line, col := tk.Line, tk.LinePos
+
+		for _, r := range tk.Data {
+			if r == '\n' {
+				line++
+				col = 0
+
+				continue
+			} else if utf16.RuneLen(r) == 2 {
+				astral[line] = append(astral[line], col)
+			}
+
+			col++
+		}
+	}
+
+	return astral
+}
+
+func (a astralRunes) column(tk *javascript.Token) int {
+	col := int(tk.LinePos)
+
+	for _, c := range a[tk.Line] {
+		if c < tk.LinePos {
+			col++
+		}
+	}
+
+	return col
+}
+
+type sourceMap struct {
+	Version  int      `json:"version"`
+	File     string   `json:"file,omitempty"`
+	Sources  []string `json:"sources"`
+	Names    []string `json:"names"`
+	Mappings string   `json:"mappings"`
+}
+
+type mapping struct {
+	genLine, genCol, source, srcLine, srcCol int
+}
+
+// Generate creates a JSON encoded source map for the given output, which must
+// be the printed form of the module returned by Package.
+//
+// The file param sets the name of the generated file in the source map and
+// may be empty.
+func (s *SourceMapper) Generate(file, output string) ([]byte, error) {
+	return s.generate("", file, output)
+}
+
+// GenerateChunk creates a JSON encoded source map for the given output, which
+// must be the printed form of the chunk passed to the SplitDynamic func with
+// the given URL.
+//
+// The file param sets the name of the generated file in the source map and
+// may be empty.
+func (s *SourceMapper) GenerateChunk(url, file, output string) ([]byte, error) {
+	return s.generate(url, file, output)
+}
+
+func (s *SourceMapper) generate(url, file, output string) ([]byte, error) {
+	s.mu.Lock()
+	tokens := s.outputs[url]
+	s.mu.Unlock()
+
+	var (
+		lines    = lineStartsOf(output)
+		sources  = []string{}
+		indexes  = make(map[string]int)
+		mappings []mapping
+	)
+
+	ms, err := alignTokens(output, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("error tokenising output: %w", err)
+	}
+
+	for _, m := range ms {
+		source, ok := indexes[m.source.url]
+		if !ok {
+			source = len(sources)
+			indexes[m.source.url] = source
+			sources = append(sources, s.source(m.source.url))
+		}
+
+		line, col := lines.position(output, m.offset)
+
+		mappings = append(mappings, mapping{
+			genLine: line,
+			genCol:  col,
+			source:  source,
+			srcLine: m.source.line,
+			srcCol:  m.source.col,
+		})
+	}
+
+	return json.Marshal(sourceMap{
+		Version:  3,
+		File:     file,
+		Sources:  sources,
+		Names:    []string{},
+		Mappings: encodeMappings(mappings),
+	})
+}
+
+type lineStarts []int
+
+func lineStartsOf(output string) lineStarts {
+	starts := lineStarts{0}
+
+	for n, c := range output {
+		if c == '\n' {
+			starts = append(starts, n+1)
+		}
+	}
+
+	return starts
+}
+
+func (l lineStarts) position(output string, offset int) (int, int) {
+	line := sort.SearchInts(l, offset+1) - 1
+	col := 0
+
+	for _, r := range output[l[line]:offset] {
+		col += utf16.RuneLen(r)
+	}
+
+	return line, col
+}
+
+type tokenMapping struct {
+	offset int
+	source *sourceToken
+}
+
+// alignTokens matches the tokens of the printed output with the recorded
+// tokens, which are printed in the same order, returning the offset of each
+// one that has a source position.
+//
+// A recorded token that does not appear in the output, such as an export name
+// that is only printed once, is skipped when the following token matches.
+func alignTokens(output string, tokens []sourceToken) ([]tokenMapping, error) {
+	var (
+		tk       = parser.NewStringTokeniser(output)
+		t        = javascript.SetTokeniser(&tk)
+		offset   int
+		next     int
+		mappings []tokenMapping
+	)
+
+	for {
+		out, err := t.GetToken()
+		if err != nil {
+			return nil, err
+		} else if out.Type == parser.TokenDone {
+			return mappings, nil
+		}
+
+		if isSignificant(out.Type) && next < len(tokens) {
+			if out.Data != tokens[next].Data && next+1 < len(tokens) && out.Data == tokens[next+1].Data {
+				next++
+			}
+
+			if out.Data == tokens[next].Data {
+				if tokens[next].url != "" {
+					mappings = append(mappings, tokenMapping{offset: offset, source: &tokens[next]})
+				}
+
+				next++
+			}
+		}
+
+		offset += len(out.Data)
+	}
+}
+
+func isSignificant(typ parser.TokenType) bool {
+	switch typ {
+	case javascript.TokenWhitespace, javascript.TokenLineTerminator, javascript.TokenSingleLineComment, javascript.TokenMultiLineComment:
+		return false
+	}
+
+	return true
+}
+
+func encodeMappings(mappings []mapping) string {
+	var (
+		sb                                 strings.Builder
+		line, col, source, srcLine, srcCol int
+		first                              = true
+	)
+
+	for _, m := range mappings {
+		for line < m.genLine {
+			sb.WriteByte(';')
+
+			line++
+			col = 0
+			first = true
+		}
+
+		if !first {
+			sb.WriteByte(',')
+		}
+
+		first = false
+
+		writeVLQ(&sb, m.genCol-col)
+		writeVLQ(&sb, m.source-source)
+		writeVLQ(&sb, m.srcLine-srcLine)
+		writeVLQ(&sb, m.srcCol-srcCol)
+
+		col = m.genCol
+		source = m.source
+		srcLine = m.srcLine
+		srcCol = m.srcCol
+	}
+
+	return sb.String()
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func writeVLQ(sb *strings.Builder, n int) {
+	v := n << 1
+
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+
+	for {
+		digit := v & 31
+		v >>= 5
+
+		if v > 0 {
+			digit |= 32
+		}
+
+		sb.WriteByte(base64Chars[digit])
+
+		if v == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package jspacker
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/parser"
+)
+
+func TestEncodeMappings(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  []mapping
+		Output string
+	}{
+		{ // 1
+			nil,
+			"",
+		},
+		{ // 2
+			[]mapping{{}},
+			"AAAA",
+		},
+		{ // 3
+			[]mapping{
+				{},
+				{genCol: 6, srcCol: 6},
+				{genLine: 2, srcLine: 1},
+			},
+			"AAAA,MAAM;;AACN",
+		},
+		{ // 4
+			[]mapping{
+				{genCol: 16, source: 1, srcLine: 100, srcCol: 3},
+			},
+			"gBCoGG",
+		},
+	} {
+		if output := encodeMappings(test.Input); output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    loader
+		Format   OutputFormat
+		Sources  []string
+		Mappings []mapping
+	}{
+		{ // 1
+			Input: loader{
+				"/a.js": "import {b} from './b.js';\n\nconsole.log(b);",
+				"/b.js": "// comment\nexport const b = 1;",
+			},
+			Sources: []string{"/b.js", "/a.js"},
+			Mappings: []mapping{
+				{source: 0, srcLine: 1, srcCol: 13},
+				{source: 0, srcLine: 1, srcCol: 17},
+				{source: 1, srcLine: 2, srcCol: 0},
+				{source: 1, srcLine: 2, srcCol: 8},
+				{source: 1, srcLine: 2, srcCol: 12},
+			},
+		},
+		{ // 2
+			Input: loader{
+				"/a.js": "import {b} from './b.js';\n\nconsole.log(b);",
+				"/b.js": "// comment\nexport const b = 1;",
+			},
+			Format:  FormatIIFE,
+			Sources: []string{"/b.js", "/a.js"},
+			Mappings: []mapping{
+				{source: 0, srcLine: 1, srcCol: 13},
+				{source: 0, srcLine: 1, srcCol: 17},
+				{source: 1, srcLine: 2, srcCol: 0},
+				{source: 1, srcLine: 2, srcCol: 8},
+				{source: 1, srcLine: 2, srcCol: 12},
+			},
+		},
+		{ // 3
+			Input: loader{
+				"/a.js": "function f(a) {\n\treturn `${a}-${a + 1}`;\n}\n\nconsole.log(f(1));",
+			},
+			Format:  FormatUMD,
+			Sources: []string{"/a.js"},
+			Mappings: []mapping{
+				{source: 0, srcLine: 0, srcCol: 9},
+				{source: 0, srcLine: 0, srcCol: 11},
+				{source: 0, srcLine: 1, srcCol: 8},
+				{source: 0, srcLine: 1, srcCol: 11},
+				{source: 0, srcLine: 1, srcCol: 12},
+				{source: 0, srcLine: 1, srcCol: 16},
+				{source: 0, srcLine: 1, srcCol: 20},
+				{source: 0, srcLine: 1, srcCol: 21},
+				{source: 0, srcLine: 4, srcCol: 12},
+				{source: 0, srcLine: 4, srcCol: 14},
+			},
+		},
+		{ // 4
+			Input: loader{
+				"/a.js": "const s = \"\U0001F600\", t = 1;\nconsole.log(s, t);",
+			},
+			Format:  FormatCJS,
+			Sources: []string{"/a.js"},
+			Mappings: []mapping{
+				{source: 0, srcLine: 0, srcCol: 6},
+				{source: 0, srcLine: 0, srcCol: 10},
+				{source: 0, srcLine: 0, srcCol: 16},
+				{source: 0, srcLine: 0, srcCol: 20},
+				{source: 0, srcLine: 1, srcCol: 15},
+			},
+		},
+	} {
+		var (
+			sm   SourceMapper
+			opts = []Option{File("/a.js"), SourceMap(&sm), Loader(test.Input.load)}
+		)
+
+		if test.Format != FormatESM {
+			opts = append(opts, Format(test.Format, ""))
+		}
+
+		m, err := Package(opts...)
+		if err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+
+			continue
+		}
+
+		output := fmt.Sprintf("%+s", m)
+
+		data, err := sm.Generate("out.js", output)
+		if err != nil {
+			t.Errorf("test %d: unexpected err: %s", n+1, err)
+
+			continue
+		}
+
+		checkSourceMap(t, n+1, test.Input, output, data, test.Sources, test.Mappings)
+	}
+}
+
+func TestGenerateChunk(t *testing.T) {
+	var (
+		sm     SourceMapper
+		chunks = make(map[string]string)
+		input  = loader{
+			"/a.js": "import('./b.js').then(({b}) => console.log(b));",
+			"/b.js": "export const b = 1;",
+		}
+	)
+
+	if _, err := Package(File("/a.js"), SourceMap(&sm), SplitDynamic("/", func(url string, m *javascript.Module) {
+		chunks[url] = fmt.Sprintf("%+s", m)
+	}), Loader(input.load)); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	output, ok := chunks["/chunk-b.js"]
+	if !ok {
+		t.Fatalf("expecting chunk /chunk-b.js, got %v", slices.Collect(maps.Keys(chunks)))
+	}
+
+	data, err := sm.GenerateChunk("/chunk-b.js", "chunk-b.js", output)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	checkSourceMap(t, 1, input, output, data, []string{"/b.js"}, []mapping{
+		{source: 0, srcLine: 0, srcCol: 13},
+		{source: 0, srcLine: 0, srcCol: 17},
+	})
+}
+
+func checkSourceMap(t *testing.T, n int, input loader, output string, data []byte, sources []string, expected []mapping) {
+	t.Helper()
+
+	var decoded sourceMap
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Errorf("test %d: unexpected err: %s", n, err)
+
+		return
+	} else if !reflect.DeepEqual(decoded.Sources, sources) {
+		t.Errorf("test %d: expecting sources %v, got %v", n, sources, decoded.Sources)
+
+		return
+	} else if decoded.Version != 3 {
+		t.Errorf("test %d: expecting version 3 map, got version %d", n, decoded.Version)
+	}
+
+	outLines := strings.Split(output, "\n")
+	found := make(map[mapping]bool)
+
+	for _, m := range decodeMappings(t, decoded.Mappings) {
+		srcLines := strings.Split(input[decoded.Sources[m.source]], "\n")
+
+		if gen, src := fromColumn(outLines[m.genLine], m.genCol), fromColumn(srcLines[m.srcLine], m.srcCol); gen == "" || src == "" || gen[0] != src[0] {
+			t.Errorf("test %d: mapping %v: generated %q does not match source %q", n, m, gen, src)
+		}
+
+		found[mapping{source: m.source, srcLine: m.srcLine, srcCol: m.srcCol}] = true
+	}
+
+	for _, m := range expected {
+		if !found[m] {
+			t.Errorf("test %d: expecting mapping to %s:%d:%d", n, decoded.Sources[m.source], m.srcLine+1, m.srcCol+1)
+		}
+	}
+}
+
+// fromColumn returns the remainder of the line starting at the given UTF-16
+// column.
+func fromColumn(line string, col int) string {
+	units := utf16.Encode([]rune(line))
+
+	if col > len(units) {
+		return ""
+	}
+
+	return string(utf16.Decode(units[col:]))
+}
+
+func TestAstralRunes(t *testing.T) {
+	tks := javascript.Tokens{
+		{Token: parser.Token{Type: javascript.TokenStringLiteral, Data: "\"\U0001F600\""}, Line: 0, LinePos: 0},
+		{Token: parser.Token{Type: javascript.TokenPunctuator, Data: ";"}, Line: 0, LinePos: 3},
+		{Token: parser.Token{Type: javascript.TokenNoSubstitutionTemplate, Data: "`\n\U0001F600\u00e9\U0001F600`"}, Line: 0, LinePos: 4},
+		{Token: parser.Token{Type: javascript.TokenIdentifier, Data: "a"}, Line: 1, LinePos: 5},
+		{Token: parser.Token{Type: javascript.TokenIdentifier, Data: "b"}, Line: 2, LinePos: 0},
+	}
+	astral := astralRunesOf(tks)
+
+	for n, test := range [...]struct {
+		Token  int
+		Output int
+	}{
+		{ // 1
+			0, 0,
+		},
+		{ // 2
+			1, 4,
+		},
+		{ // 3
+			2, 5,
+		},
+		{ // 4
+			3, 7,
+		},
+		{ // 5
+			4, 0,
+		},
+	} {
+		if output := astral.column(&tks[test.Token]); output != test.Output {
+			t.Errorf("test %d: expecting column %d, got %d", n+1, test.Output, output)
+		}
+	}
+}
+
+func decodeMappings(t *testing.T, mappings string) []mapping {
+	t.Helper()
+
+	var (
+		decoded []mapping
+		last    mapping
+	)
+
+	for line, segments := range strings.Split(mappings, ";") {
+		last.genCol = 0
+
+		if segments == "" {
+			continue
+		}
+
+		for _, segment := range strings.Split(segments, ",") {
+			var fields []int
+
+			for v, shift := 0, 0; segment != ""; segment = segment[1:] {
+				digit := strings.IndexByte(base64Chars, segment[0])
+				v |= (digit & 31) << shift
+				shift += 5
+
+				if digit&32 == 0 {
+					if v&1 == 1 {
+						fields = append(fields, -(v >> 1))
+					} else {
+						fields = append(fields, v>>1)
+					}
+
+					v, shift = 0, 0
+				}
+			}
+
+			if len(fields) != 4 {
+				t.Fatalf("expecting 4 fields in segment, got %v", fields)
+			}
+
+			last.genLine = line
+			last.genCol += fields[0]
+			last.source += fields[1]
+			last.srcLine += fields[2]
+			last.srcCol += fields[3]
+
+			decoded = append(decoded, last)
+		}
+	}
+
+	return decoded
+}
@@ -0,0 +1,325 @@
+package jspacker
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/javascript"
+)
+
+type chunk struct {
+	name, url string
+	root      *dependency
+	files     []*dependency
+	items     []*moduleItem
+	exports   map[string]struct{}
+	module    *javascript.Module
+}
+
+type mainExport struct {
+	url, binding string
+}
+
+type includeBinding struct {
+	local, binding string
+}
+
+func (c *config) split() error {
+	var (
+		main       = c.staticClosure(nil, c.entries())
+		roots      []*dependency
+		rootChunks = make(map[*dependency]*chunk)
+		owners     = make(map[*dependency][]*dependency)
+	)
+
+	for _, file := range sortedMap(c.filesDone) {
+		if file.dynamicImport && !main[file] {
+			roots = append(roots, file)
+		}
+	}
+
+	for _, root := range roots {
+		ch := c.newChunk(chunkName(root.url))
+		ch.root = root
+		rootChunks[root] = ch
+
+		for file := range c.staticClosure(main, []*dependency{root}) {
+			owners[file] = append(owners[file], root)
+		}
+	}
+
+	commonChunks := make(map[string]*chunk)
+
+	for _, file := range sortedMap(c.filesDone) {
+		rs := owners[file]
+
+		switch len(rs) {
+		case 0:
+			continue
+		case 1:
+			file.chunk = rootChunks[rs[0]]
+		default:
+			names := make([]string, len(rs))
+
+			for n, r := range rs {
+				names[n] = chunkName(r.url)
+			}
+
+			name := strings.Join(names, "-")
+
+			ch, ok := commonChunks[name]
+			if !ok {
+				ch = c.newChunk(name)
+				commonChunks[name] = ch
+			}
+
+			file.chunk = ch
+		}
+
+		file.chunk.files = append(file.chunk.files, file)
+	}
+
+	for _, item := range c.items {
+		if item.keep && item.dependency.chunk != nil {
+			item.dependency.chunk.items = append(item.dependency.chunk.items, item)
+		}
+	}
+
+	for _, tk := range c.dynamicURLs {
+		if url, err := javascript.Unquote(tk.Data); err == nil {
+			if ch, ok := rootChunks[c.filesDone[url]]; ok {
+				tk.Data = strconv.Quote(ch.url)
+			}
+		}
+	}
+
+	return c.buildChunks()
+}
+
+func (c *config) newChunk(name string) *chunk {
+	unique := name
+
+	for n := 2; slices.ContainsFunc(c.chunks, func(ch *chunk) bool { return ch.name == unique }); n++ {
+		unique = name + "-" + strconv.Itoa(n)
+	}
+
+	ch := &chunk{
+		name:    unique,
+		url:     path.Join(c.splitDir, "chunk-"+unique+".js"),
+		exports: make(map[string]struct{}),
+	}
+
+	c.chunks = append(c.chunks, ch)
+
+	return ch
+}
+
+func chunkName(url string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(strings.TrimSuffix(url, path.Ext(url)), "/"), "/", "-")
+}
+
+func (c *config) entries() []*dependency {
+	var entries []*dependency
+
+	for _, file := range sortedMap(c.filesDone) {
+		if file.entry {
+			entries = append(entries, file)
+		}
+	}
+
+	return entries
+}
+
+func (c *config) staticClosure(exclude map[*dependency]bool, from []*dependency) map[*dependency]bool {
+	closure := make(map[*dependency]bool)
+	todo := slices.Clone(from)
+
+	for len(todo) > 0 {
+		file := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		if closure[file] || exclude[file] {
+			continue
+		}
+
+		closure[file] = true
+
+		for _, r := range sortedMap(file.requires) {
+			todo = append(todo, r)
+		}
+	}
+
+	return closure
+}
+
+func (c *config) buildChunks() error {
+	owners := make(map[string]*chunk)
+	mainExports := make(map[string]mainExport)
+
+	for _, file := range sortedMap(c.filesDone) {
+		owners[file.prefix] = file.chunk
+
+		if file.chunk != nil {
+			continue
+		}
+
+		mainExports[file.prefix] = mainExport{url: file.url, binding: "*"}
+
+		for binding := range sortedMap(file.exports) {
+			if b := file.resolveExport(binding); b != nil {
+				if _, ok := mainExports[b.Data]; !ok {
+					mainExports[b.Data] = mainExport{url: file.url, binding: binding}
+				}
+			}
+		}
+	}
+
+	for _, item := range c.items {
+		if item.keep {
+			for _, tk := range item.declares {
+				owners[tk.Data] = item.dependency.chunk
+			}
+		}
+	}
+
+	refs := make([]map[string]struct{}, len(c.chunks))
+
+	for n, ch := range c.chunks {
+		r, err := ch.references(c)
+		if err != nil {
+			return err
+		}
+
+		refs[n] = r
+
+		for name := range r {
+			if owner := owners[name]; owner != nil && owner != ch {
+				owner.exports[name] = struct{}{}
+			}
+		}
+	}
+
+	for n, ch := range c.chunks {
+		if err := ch.build(c, refs[n], owners, mainExports); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ch *chunk) references(c *config) (map[string]struct{}, error) {
+	refs := make(map[string]struct{})
+
+	for _, item := range ch.items {
+		for _, tk := range item.refs {
+			refs[tk.Data] = struct{}{}
+		}
+	}
+
+	for _, file := range ch.files {
+		if file.requireNamespace {
+			_, names, err := c.namespace(file)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range names {
+				refs[name] = struct{}{}
+			}
+		}
+	}
+
+	if ch.root != nil {
+		for binding := range ch.root.exports {
+			b := ch.root.resolveExport(binding)
+			if b == nil {
+				return nil, ch.root.error("", binding, nil, ErrInvalidExport)
+			}
+
+			refs[b.Data] = struct{}{}
+		}
+	}
+
+	return refs, nil
+}
+
+func (ch *chunk) build(c *config, refs map[string]struct{}, owners map[string]*chunk, mainExports map[string]mainExport) error {
+	var (
+		chunkImports = make(map[string][]string)
+		mainImports  = make(map[string][]includeBinding)
+		items        []javascript.ModuleItem
+	)
+
+	for name := range sortedMap(refs) {
+		owner, ok := owners[name]
+		if !ok || owner == ch {
+			continue
+		} else if owner != nil {
+			chunkImports[owner.url] = append(chunkImports[owner.url], name)
+		} else if me, ok := mainExports[name]; !ok {
+			return fmt.Errorf("error resolving binding %s for chunk %s: %w", name, ch.url, ErrInvalidExport)
+		} else {
+			mainImports[me.url] = append(mainImports[me.url], includeBinding{local: name, binding: me.binding})
+		}
+	}
+
+	for url, names := range sortedMap(chunkImports) {
+		items = append(items, wrapNamedImport(url, names))
+	}
+
+	for url, bindings := range sortedMap(mainImports) {
+		items = append(items, wrapIncludeBindings(url, bindings))
+	}
+
+	var namespaces []javascript.LexicalBinding
+
+	for _, file := range ch.files {
+		if file.requireNamespace {
+			ns, _, err := c.namespace(file)
+			if err != nil {
+				return err
+			}
+
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	if len(namespaces) > 0 {
+		items = append(items, wrapConst(namespaces))
+	}
+
+	for _, item := range ch.items {
+		items = append(items, item.ModuleItem)
+	}
+
+	var exports []javascript.ExportSpecifier
+
+	if ch.root != nil {
+		for binding := range sortedMap(ch.root.exports) {
+			exports = append(exports, javascript.ExportSpecifier{
+				IdentifierName:  jToken(ch.root.resolveExport(binding).Data),
+				EIdentifierName: jToken(binding),
+			})
+		}
+	}
+
+	for name := range sortedMap(ch.exports) {
+		exports = append(exports, javascript.ExportSpecifier{
+			IdentifierName: jToken(name),
+		})
+	}
+
+	if len(exports) > 0 {
+		items = append(items, wrapExportClause(exports))
+	}
+
+	ch.module = &javascript.Module{
+		ModuleListItems: items,
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package jspacker
+
+import (
+	"sort"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/javascript/scope"
+)
+
+func (d *dependency) mapItemBindings() {
+	if !d.config.treeShake && d.config.splitFn == nil {
+		return
+	}
+
+	for _, bindings := range d.scope.Bindings {
+		if len(bindings) == 0 || bindings[0].BindingType == scope.BindingRef || bindings[0].BindingType == scope.BindingBare {
+			continue
+		}
+
+		if item := d.itemContaining(bindings[0].Token); item != nil && bindings[0].BindingType != scope.BindingImport {
+			item.declares = append(item.declares, bindings[0].Token)
+		}
+
+		for _, ref := range bindings[1:] {
+			if item := d.itemContaining(ref.Token); item != nil {
+				item.refs = append(item.refs, ref.Token)
+			} else {
+				d.config.shakeRoots = append(d.config.shakeRoots, ref.Token)
+			}
+		}
+	}
+}
+
+func (d *dependency) itemContaining(tk *javascript.Token) *moduleItem {
+	if tk == nil {
+		return nil
+	}
+
+	n := sort.Search(len(d.sourceItems), func(n int) bool {
+		tks := d.sourceItems[n].tokens
+
+		return tks[len(tks)-1].Pos >= tk.Pos
+	})
+
+	if n < len(d.sourceItems) {
+		if tks := d.sourceItems[n].tokens; tks[0].Pos <= tk.Pos {
+			return d.sourceItems[n]
+		}
+	}
+
+	return nil
+}
+
+func (c *config) shake() {
+	var (
+		declared  = make(map[string][]*moduleItem)
+		todo      []*moduleItem
+		reachable = make(map[string]struct{})
+	)
+
+	for _, item := range c.items {
+		item.keep = false
+
+		for _, tk := range item.declares {
+			declared[tk.Data] = append(declared[tk.Data], item)
+		}
+
+		if !isPureItem(item.ModuleItem) {
+			todo = append(todo, item)
+		}
+	}
+
+	reach := func(name string) {
+		if _, ok := reachable[name]; !ok {
+			reachable[name] = struct{}{}
+			todo = append(todo, declared[name]...)
+		}
+	}
+
+	for _, tk := range c.shakeRoots {
+		reach(tk.Data)
+	}
+
+	for _, file := range sortedMap(c.filesDone) {
+		reachable[file.prefix] = struct{}{}
+
+		if !file.exportsRequired() {
+			continue
+		}
+
+		for binding := range sortedMap(file.exports) {
+			if b := file.resolveExport(binding); b != nil {
+				reach(b.Data)
+			}
+		}
+	}
+
+	for len(todo) > 0 {
+		item := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		if item.keep {
+			continue
+		}
+
+		item.keep = true
+
+		for _, tk := range item.declares {
+			reach(tk.Data)
+		}
+
+		for _, tk := range item.refs {
+			reach(tk.Data)
+		}
+	}
+
+	c.reachable = reachable
+}
+
+func (d *dependency) exportsRequired() bool {
+	return d.primary || d.entry && !d.config.bare || d.requireNamespace || d.dynamicImport
+}
+
+func (c *config) isReachable(file *dependency, b *scope.Binding) bool {
+	if c.reachable == nil || file.exportsRequired() {
+		return true
+	}
+
+	_, ok := c.reachable[b.Data]
+
+	return ok
+}
+
+func isPureItem(mi javascript.ModuleItem) bool {
+	if mi.StatementListItem == nil {
+		return false
+	} else if mi.StatementListItem.Declaration != nil {
+		return isPureDeclaration(mi.StatementListItem.Declaration)
+	} else if s := mi.StatementListItem.Statement; s != nil && s.VariableStatement != nil {
+		return isPureBindings(s.VariableStatement.VariableDeclarationList)
+	}
+
+	return false
+}
+
+func isPureDeclaration(d *javascript.Declaration) bool {
+	if d.FunctionDeclaration != nil {
+		return true
+	} else if d.ClassDeclaration != nil {
+		return isPureClass(d.ClassDeclaration)
+	} else if d.LexicalDeclaration != nil {
+		return isPureBindings(d.LexicalDeclaration.BindingList)
+	}
+
+	return false
+}
+
+func isPureBindings(lbs []javascript.LexicalBinding) bool {
+	for _, lb := range lbs {
+		if lb.Initializer == nil {
+			continue
+		} else if lb.BindingIdentifier == nil || !isPure(lb.Initializer) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isPureClass(cd *javascript.ClassDeclaration) bool {
+	if h := cd.ClassHeritage; h != nil && (h.NewExpression == nil || h.NewExpression.MemberExpression.PrimaryExpression == nil || h.NewExpression.MemberExpression.PrimaryExpression.IdentifierReference == nil) {
+		return false
+	}
+
+	for _, ce := range cd.ClassBody {
+		if ce.Static && ce.MethodDefinition == nil {
+			return false
+		} else if ce.MethodDefinition != nil && isComputed(ce.MethodDefinition.ClassElementName) || ce.FieldDefinition != nil && isComputed(ce.FieldDefinition.ClassElementName) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isComputed determines whether the given name is a computed key, which is
+// evaluated when its class or object is created.
+func isComputed(cen javascript.ClassElementName) bool {
+	return cen.PropertyName != nil && cen.PropertyName.ComputedPropertyName != nil
+}
+
+func isPure(ae *javascript.AssignmentExpression) bool {
+	if ae.ArrowFunction != nil {
+		return true
+	} else if ae.ConditionalExpression == nil || ae.AssignmentOperator != javascript.AssignmentNone || ae.Yield {
+		return false
+	}
+
+	pe, ok := javascript.UnwrapConditional(ae.ConditionalExpression).(*javascript.PrimaryExpression)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case pe.Literal != nil, pe.IdentifierReference != nil, pe.This != nil, pe.FunctionExpression != nil:
+		return true
+	case pe.ClassExpression != nil:
+		return isPureClass(pe.ClassExpression)
+	case pe.TemplateLiteral != nil:
+		return pe.TemplateLiteral.NoSubstitutionTemplate != nil
+	case pe.ArrayLiteral != nil:
+		for _, ae := range pe.ArrayLiteral.ElementList {
+			if ae.Spread || !isPure(&ae.AssignmentExpression) {
+				return false
+			}
+		}
+
+		return true
+	case pe.ObjectLiteral != nil:
+		for _, pd := range pe.ObjectLiteral.PropertyDefinitionList {
+			if pd.PropertyName == nil && pd.MethodDefinition == nil { // spread properties read every property of their value, which may call getters
+				return false
+			} else if pd.PropertyName != nil && pd.PropertyName.ComputedPropertyName != nil || pd.MethodDefinition != nil && isComputed(pd.MethodDefinition.ClassElementName) || pd.AssignmentExpression != nil && !isPure(pd.AssignmentExpression) {
+				return false
+			}
+		}
+
+		return true
+	case pe.ParenthesizedExpression != nil:
+		for _, ae := range pe.ParenthesizedExpression.Expressions {
+			if !isPure(&ae) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package jspacker
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/javascript"
+	"vimagination.zapto.org/javascript/scope"
+	"vimagination.zapto.org/javascript/walk"
+)
+
+// Warning describes a suspicious, but non-fatal, construct found while
+// processing modules.
+type Warning struct {
+	Kind WarningKind
+
+	// URL is the module in which the construct was found.
+	URL string
+
+	// Line and Column are the 1-indexed position of the construct in the
+	// module; these are zero when the position is unknown.
+	Line, Column uint64
+
+	Message string
+}
+
+// String returns the position and message of the warning.
+func (w Warning) String() string {
+	if w.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", w.URL, w.Line, w.Column, w.Message)
+	}
+
+	return w.URL + ": " + w.Message
+}
+
+// WarningKind determines the type of construct a Warning describes.
+type WarningKind uint8
+
+// Warning kinds.
+const (
+	// WarnUnusedImport is an imported binding that is never referenced.
+	WarnUnusedImport WarningKind = iota
+
+	// WarnUnusedModule is a module, with exports, that is imported, but none
+	// of whose exports are used.
+	WarnUnusedModule
+
+	// WarnExportCollision is a name exported by more than one module
+	// re-exported with `export *`, where the first export found is used.
+	WarnExportCollision
+
+	// WarnDynamicImport is a dynamic import() or include() call whose
+	// specifier is not a string literal, and so cannot be resolved.
+	WarnDynamicImport
+
+	// WarnDirectEval is a direct call to eval, which can reference bindings
+	// that will have been renamed.
+	WarnDirectEval
+)
+
+func (d *dependency) warn(kind WarningKind, tk *javascript.Token, format string, args ...any) {
+	if d.config == nil || d.config.warnFn == nil {
+		return
+	}
+
+	w := Warning{
+		Kind:    kind,
+		URL:     d.url,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	if tk != nil {
+		w.Line = tk.Line + 1
+		w.Column = tk.LinePos + 1
+	}
+
+	d.config.warnFn(w)
+}
+
+func (d *dependency) warnUnusedImports() {
+	for name, ib := range sortedMap(d.imports) {
+		if bindings := d.scope.Bindings[name]; len(bindings) == 1 {
+			d.warn(WarnUnusedImport, bindings[0].Token, "unused import %s from %s", name, ib.url)
+		}
+	}
+}
+
+func (d *dependency) warnDirectEval(module *javascript.Module) {
+	if bindings := d.scope.Bindings["eval"]; len(bindings) == 0 || bindings[0].BindingType != scope.BindingRef && bindings[0].BindingType != scope.BindingBare {
+		return
+	}
+
+	var find walk.HandlerFunc
+
+	find = func(t javascript.Type) error {
+		if ce, ok := t.(*javascript.CallExpression); ok && ce.Arguments != nil && ce.MemberExpression != nil && ce.MemberExpression.PrimaryExpression != nil && ce.MemberExpression.PrimaryExpression.IdentifierReference != nil && ce.MemberExpression.PrimaryExpression.IdentifierReference.Data == "eval" {
+			d.warn(WarnDirectEval, ce.MemberExpression.PrimaryExpression.IdentifierReference, "direct eval may reference renamed bindings")
+		}
+
+		return walk.Walk(t, find)
+	}
+
+	walk.Walk(module, find)
+}
+
+func (c *config) warnUnusedModules() {
+	used := make(map[*dependency]bool)
+
+	for _, d := range c.filesDone {
+		for name, ib := range d.imports {
+			if len(d.scope.Bindings[name]) > 1 {
+				used[ib.dependency] = true
+			}
+		}
+
+		for _, ib := range d.exports {
+			if ib.dependency != nil {
+				used[ib.dependency] = true
+			}
+		}
+	}
+
+	for _, eaf := range c.exportAllFrom {
+		used[eaf[1]] = true
+	}
+
+	for _, importer := range sortedMap(c.filesDone) {
+		for _, d := range importer.requireOrder {
+			if !used[d] && len(d.exports) > 0 && !d.entry && !d.cjs && !d.dynamicImport && !d.requireNamespace {
+				importer.warn(WarnUnusedModule, nil, "none of the exports of %s are used", d.url)
+			}
+		}
+	}
+}
+
+func (c *config) warnExportCollisions() {
+	for _, eaf := range c.exportAllFrom {
+		for export := range sortedMap(eaf[1].exports) {
+			existing, ok := eaf[0].exports[export]
+			if export == "default" || !ok || !existing.star || existing.dependency == eaf[1] {
+				continue
+			}
+
+			ad, ab := existing.dependency.exportSource(existing.binding)
+
+			if bd, bb := eaf[1].exportSource(export); ad != bd || ab != bb {
+				eaf[0].warn(WarnExportCollision, nil, "export * of %s from %s is ignored, as it is also exported from %s", export, eaf[1].url, existing.url)
+			}
+		}
+	}
+}